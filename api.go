@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/signal"
+)
+
+// Marshalable form of an error, as returned by the JSON API.
+type jsonError struct {
+
+	// description of what went wrong
+	Error string `json:"error"`
+}
+
+//! Writes the given value as the JSON body of a response.
+/*
+ * @param      http.ResponseWriter    destination of the response
+ * @param      int                    HTTP status code of the response
+ * @param      interface{}            value to marshal
+ *
+ * @returns    none
+ */
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+
+	output, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		status = http.StatusInternalServerError
+		output = []byte(`{"error": "unable to marshal the response"}`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, string(output))
+}
+
+//! Serves the /sensors endpoint, re-reading the sensors on every request.
+/*
+ * @param      http.ResponseWriter    destination of the response
+ * @param      http.Request           sensors request
+ *
+ * @returns    none
+ */
+func handleSensors(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed,
+			jsonError{"only GET is supported"})
+		return
+	}
+
+	devices, err := ScanDevices()
+
+	// A scan that ran out of time still has readings worth reporting.
+	if err != nil && err != errScanDeadline {
+		writeJSON(w, http.StatusInternalServerError, jsonError{err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, jsonSensors(devices))
+}
+
+//! Runs the JSON API server until it fails.
+/*
+ * @param      string    address to listen on, e.g. :8080
+ *
+ * @returns    error     why the server stopped
+ */
+func serveSensors(address string) error {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sensors", handleSensors)
+
+	// Each request scans afresh, so a SIGHUP need only forget the names.
+	hangups := notifyRescans()
+	defer signal.Stop(hangups)
+
+	go func() {
+		for range hangups {
+			rescanDevices()
+		}
+	}()
+
+	debug("Serving sensors at " + address + "/sensors")
+
+	err := http.ListenAndServe(address, mux)
+	if err != nil {
+		return fmt.Errorf("serveSensors(): %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rbisewski/tempchk/pkg/tempchk"
+)
+
+//! Assembles the identity of a sensor, which is stable across reboots.
+/*
+ * @param      Device    device the sensor belongs to
+ * @param      Sensor    sensor to identify
+ *
+ * @returns    string    identity of the sensor; e.g. "k10temp temp1"
+ */
+func sensorIdentity(device Device, sensor tempchk.Sensor) string {
+	return device.name + " " + sensor.Category + strconv.Itoa(sensor.Number)
+}
+
+//! Saves the currently present sensors, and their values, to a baseline.
+/*
+ * The baseline is a plain text file with one sensor per line, formatted
+ * as the sensor identity followed by its value and unit; e.g.
+ * "k10temp temp1 45 C". The unit lets a baseline saved with one -unit be
+ * compared against a scan of another.
+ *
+ * @param      string    path of the baseline file
+ *
+ * @returns    error     error message, if any
+ */
+func saveBaselineFile(path string) error {
+
+	devices, err := ScanDevices()
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	count := 0
+
+	for _, device := range devices {
+		for _, sensor := range device.sensors {
+			line := sensorIdentity(device, sensor) + " " +
+				strconv.Itoa(sensor.IntData)
+			if unit := baselineUnit(sensor.Category); unit != "" {
+				line += " " + unit
+			}
+			b.WriteString(line + "\n")
+			count++
+		}
+	}
+
+	err = ioutil.WriteFile(path, []byte(b.String()), 0644)
+	if err != nil {
+		return fmt.Errorf("saveBaselineFile(): unable to write %s", path)
+	}
+
+	fmt.Println("tempchk: saved a baseline of " + strconv.Itoa(count) +
+		" sensors to " + path)
+
+	return nil
+}
+
+//! Determines the unit to save the values of a category in a baseline with.
+/*
+ * @param      string    sensor category, e.g. temp
+ *
+ * @returns    string    unit of the category, in the standard style; e.g.
+ *                       the -unit for temperatures, or blank if unknown
+ */
+func baselineUnit(category string) string {
+
+	if category == tempchk.TempPrefix {
+		return temperatureUnit
+	}
+
+	return unitStyles["standard"][category]
+}
+
+//! Converts a baseline temperature to the unit given by the -unit flag.
+/*
+ * @param      int       temperature, as saved in the baseline
+ * @param      string    unit it was saved in; e.g. C, F or K, or any of
+ *                       their spelled-out names
+ *
+ * @returns    int       temperature, in the unit given by the -unit flag
+ *             bool      whether or not the unit is a known one
+ */
+func baselineTemperature(value int, unit string) (int, bool) {
+
+	for symbol, name := range temperatureUnitNames {
+		if unit == name {
+			unit = symbol
+		}
+	}
+
+	var celsius float64
+	switch unit {
+	case "C":
+		celsius = float64(value)
+	case "F":
+		celsius = (float64(value) - 32) * 5 / 9
+	case "K":
+		celsius = float64(value) - kelvinOffset
+	default:
+		return 0, false
+	}
+
+	// Saved in the same unit, the value is kept exactly as it was.
+	if unit == temperatureUnit {
+		return value, true
+	}
+
+	switch temperatureUnit {
+	case "F":
+		return int(math.Round(celsius*9/5 + 32)), true
+	case "K":
+		return int(math.Round(celsius + kelvinOffset)), true
+	}
+
+	return int(math.Round(celsius)), true
+}
+
+//! Loads a previously saved baseline.
+/*
+ * The output of -json may be used as a baseline too, as is. Temperatures
+ * are converted to the -unit, whichever unit they were saved in; those of
+ * baselines saved before the unit was recorded are taken to be Celsius.
+ *
+ * @param      string            path of the baseline file
+ *
+ * @returns    map[string]int    baseline values, keyed by sensor identity,
+ *                               with temperatures in the -unit
+ *             error             error message, if any
+ */
+func loadBaselineFile(path string) (map[string]int, error) {
+
+	baseline := make(map[string]int)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return baseline, fmt.Errorf("loadBaselineFile(): unable to open %s",
+			path)
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) ||
+		bytes.HasPrefix(trimmed, []byte("{")) {
+		return loadBaselineJSON(trimmed, path)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+
+	for scanner.Scan() {
+
+		lineNumber++
+
+		fields := strings.Fields(scanner.Text())
+
+		// skip blank lines
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 3 && len(fields) != 4 {
+			return baseline, fmt.Errorf("loadBaselineFile(): malformed "+
+				"line %d in %s", lineNumber, path)
+		}
+
+		value, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return baseline, fmt.Errorf("loadBaselineFile(): invalid "+
+				"value on line %d in %s", lineNumber, path)
+		}
+
+		unit := "C"
+		if len(fields) == 4 {
+			unit = fields[3]
+		}
+
+		if strings.HasPrefix(fields[1], tempchk.TempPrefix) {
+			var ok bool
+			value, ok = baselineTemperature(value, unit)
+			if !ok {
+				return baseline, fmt.Errorf("loadBaselineFile(): unknown "+
+					"unit %s on line %d in %s", unit, lineNumber, path)
+			}
+		}
+
+		baseline[fields[0]+" "+fields[1]] = value
+	}
+
+	if scanner.Err() != nil {
+		return baseline, fmt.Errorf("loadBaselineFile(): unable to read %s",
+			path)
+	}
+
+	return baseline, nil
+}
+
+//! Loads a baseline from the output of -json, either the plain array or
+//! the object printed along with -threshold.
+/*
+ * @param      byte[]            contents of the baseline file
+ * @param      string            path of the baseline file
+ *
+ * @returns    map[string]int    baseline values, keyed by sensor identity
+ *             error             error message, if any
+ */
+func loadBaselineJSON(data []byte, path string) (map[string]int, error) {
+
+	baseline := make(map[string]int)
+
+	var sensors []tempchk.Sensor
+	if bytes.HasPrefix(data, []byte("{")) {
+		var status jsonStatus
+		err := json.Unmarshal(data, &status)
+		if err != nil {
+			return baseline, fmt.Errorf("loadBaselineJSON(): malformed "+
+				"JSON in %s", path)
+		}
+		sensors = status.Sensors
+	} else {
+		err := json.Unmarshal(data, &sensors)
+		if err != nil {
+			return baseline, fmt.Errorf("loadBaselineJSON(): malformed "+
+				"JSON in %s", path)
+		}
+	}
+
+	// The values are truncated, so that they match those of a text
+	// baseline.
+	for _, sensor := range sensors {
+
+		value := sensor.IntData
+
+		// The unit is only given if not the usual one, i.e. Celsius.
+		if sensor.Category == tempchk.TempPrefix {
+			unit := sensor.Unit
+			if unit == "" {
+				unit = "C"
+			}
+
+			var ok bool
+			value, ok = baselineTemperature(value, unit)
+			if !ok {
+				return baseline, fmt.Errorf("loadBaselineJSON(): unknown "+
+					"unit %s in %s", unit, path)
+			}
+		}
+
+		baseline[sensor.Name+" "+sensor.Category+
+			strconv.Itoa(sensor.Number)] = value
+	}
+
+	return baseline, nil
+}
+
+//! Formats how far a sensor has moved from its baseline value.
+/*
+ * @param      Device    device the sensor belongs to
+ * @param      Sensor    sensor to compare
+ *
+ * @returns    string    change and unit, e.g. +6 C, or a note if the
+ *                       sensor is not in the baseline
+ */
+func baselineDelta(device Device, sensor tempchk.Sensor) string {
+
+	previous, ok := baselineValues[sensorIdentity(device, sensor)]
+	if !ok {
+		return "not in baseline"
+	}
+
+	change := sensor.IntData - previous
+
+	sign := "+"
+	if change < 0 {
+		sign = ""
+	}
+
+	return sign + strconv.Itoa(change) + " " + categoryUnit(sensor.Category)
+}
+
+//! Gathers the identities of every sensor present, regardless of the
+//! device, label, sensor and category filters.
+/*
+ * A sensor merely filtered out of the scan is not missing, so the devices
+ * are read afresh, every category of them.
+ *
+ * @returns    map[string]bool    identities of the sensors present
+ */
+func presentSensors() map[string]bool {
+
+	present := make(map[string]bool)
+
+	// The hwmon directory may be absent, e.g. if there are only zones.
+	dirs, err := tempchk.DefaultFileSystem.ReadDir(
+		tempchk.HardwareMonitorDirectory)
+	if err != nil {
+		debug("Warning: unable to read " + tempchk.HardwareMonitorDirectory)
+	}
+
+	for _, device := range namedDevices(dirs) {
+
+		// Devices without any readable sensors have none present.
+		sensors, err := tempchk.ScanDevice(device.name, device.hwmon)
+		if err != nil {
+			continue
+		}
+
+		for _, sensor := range sensors {
+			present[sensorIdentity(device, sensor)] = true
+		}
+	}
+
+	// Thermal zones may have been in the scan the baseline was saved from.
+	for _, zone := range namedThermalZones() {
+
+		sensors, err := tempchk.ReadThermalZone(tempchk.ThermalZoneDirectory,
+			zone.name, zone.hwmon)
+		if err != nil {
+			continue
+		}
+
+		for _, sensor := range sensors {
+			present[sensorIdentity(zone, sensor)] = true
+		}
+	}
+
+	return present
+}
+
+//! Determines which sensors of a baseline are absent from those present.
+/*
+ * @param      map[string]bool    identities of the sensors present
+ * @param      map[string]int     baseline values, keyed by sensor identity
+ *
+ * @returns    string[]           sorted identities of the missing sensors
+ */
+func missingSensors(present map[string]bool, baseline map[string]int) []string {
+
+	missing := make([]string, 0)
+	for identity := range baseline {
+		if !present[identity] {
+			missing = append(missing, identity)
+		}
+	}
+
+	sort.Strings(missing)
+
+	return missing
+}
+
+//! Reports sensors of the baseline that have since disappeared.
+/*
+ * @param      io.Writer    destination of the report
+ *
+ * @returns    int          exit code; the critical exit code if any sensor
+ *                          is missing, else 0
+ */
+func reportMissing(w io.Writer) int {
+
+	missing := missingSensors(presentSensors(), baselineValues)
+	for _, identity := range missing {
+		fmt.Fprintln(w, "tempchk: "+identity+" is present in the baseline, "+
+			"but is now missing")
+	}
+
+	if len(missing) > 0 {
+		return critExitCode
+	}
+
+	return 0
+}
+
+//! Reports sensors that are missing from the baseline, faulted or in alarm.
+/*
+ * @param      io.Writer    destination of the report
+ *
+ * @returns    int          exit code; the critical exit code if a sensor is
+ *                          missing or faulted, the warning exit code if a
+ *                          sensor is in alarm, else 0
+ */
+func reportFaults(w io.Writer) int {
+
+	devices, err := ScanDevices()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	problems := make([]string, 0)
+	exitCode := 0
+
+	for _, device := range devices {
+		for _, sensor := range device.sensors {
+
+			identity := sensorIdentity(device, sensor)
+
+			if sensor.Fault {
+				problems = append(problems, "fault: "+identity)
+				exitCode = critExitCode
+			}
+
+			if sensor.Alarm {
+				problems = append(problems, "alarm: "+identity)
+				if exitCode == 0 {
+					exitCode = warnExitCode
+				}
+			}
+		}
+	}
+
+	// Without a baseline, there is no set of expected sensors to check.
+	if baselinePath != "" {
+
+		missing := missingSensors(presentSensors(), baselineValues)
+		for i := range missing {
+			missing[i] = "missing: " + missing[i]
+		}
+
+		if len(missing) > 0 {
+			exitCode = critExitCode
+		}
+
+		problems = append(missing, problems...)
+	}
+
+	for _, problem := range problems {
+		fmt.Fprintln(w, problem)
+	}
+
+	return exitCode
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/rbisewski/tempchk/pkg/tempchk"
+)
+
+// Checks that the output of -json, with and without -threshold, can be read
+// back as a baseline.
+func TestLoadBaselineJSON(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "nvme\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "38900\n",
+		"/sys/class/hwmon/hwmon0/fan1_input":  "1200\n",
+	})
+
+	threshold := thresholdTemperature
+	t.Cleanup(func() { thresholdTemperature = threshold })
+
+	devices, err := ScanDevices()
+	if err != nil {
+		t.Fatalf("ScanDevices() error = %v", err)
+	}
+
+	want := map[string]int{"nvme temp1": 38, "nvme fan1": 1200}
+
+	for _, thresholdTemperature = range []int{0, 70} {
+
+		var output bytes.Buffer
+		if err := printJSON(&output, devices); err != nil {
+			t.Fatalf("printJSON() error = %v", err)
+		}
+
+		baseline, err := loadBaselineJSON(output.Bytes(), "baseline.json")
+		if err != nil {
+			t.Errorf("-threshold %d: loadBaselineJSON() error = %v",
+				thresholdTemperature, err)
+			continue
+		}
+
+		if len(baseline) != len(want) {
+			t.Errorf("-threshold %d: loadBaselineJSON() = %v, want %v",
+				thresholdTemperature, baseline, want)
+		}
+		for key, value := range want {
+			if baseline[key] != value {
+				t.Errorf("-threshold %d: loadBaselineJSON()[%q] = %d, want %d",
+					thresholdTemperature, key, baseline[key], value)
+			}
+		}
+	}
+}
+
+// Checks that only the sensors of the baseline that are gone from the hwmon
+// directory are reported missing, and not those merely filtered out.
+func TestReportMissing(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "k10temp\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "45000\n",
+		"/sys/class/hwmon/hwmon0/temp1_label": "Tctl\n",
+		"/sys/class/hwmon/hwmon1/name":        "nct6798\n",
+		"/sys/class/hwmon/hwmon1/temp1_input": "35000\n",
+		"/sys/class/hwmon/hwmon1/temp1_label": "SYSTIN\n",
+		"/sys/class/hwmon/hwmon1/in0_input":   "1104\n",
+	})
+
+	values, device, label := baselineValues, deviceFilter, labelFilter
+	t.Cleanup(func() {
+		baselineValues, deviceFilter, labelFilter = values, device, label
+	})
+
+	baselineValues = map[string]int{
+		"k10temp temp1": 45,
+		"nct6798 temp1": 35,
+		"nct6798 in0":   1,
+		"nct6798 temp2": 40,
+		"nvme temp1":    38,
+	}
+
+	want := "tempchk: nct6798 temp2 is present in the baseline, but is " +
+		"now missing\ntempchk: nvme temp1 is present in the baseline, but " +
+		"is now missing\n"
+
+	tests := []struct {
+		device string
+		label  string
+	}{
+		{"", ""},
+		{"k10temp", ""},
+		{"", "Tctl"},
+	}
+
+	for _, test := range tests {
+
+		deviceFilter, labelFilter = test.device, test.label
+
+		var report bytes.Buffer
+		code := reportMissing(&report)
+
+		if code != critExitCode || report.String() != want {
+			t.Errorf("-device %q -label %q: reportMissing() = %d, %q, want "+
+				"%d, %q", test.device, test.label, code, report.String(),
+				critExitCode, want)
+		}
+	}
+
+	// Once the missing sensors are back, all is well again.
+	delete(baselineValues, "nct6798 temp2")
+	delete(baselineValues, "nvme temp1")
+
+	var report bytes.Buffer
+	if code := reportMissing(&report); code != 0 || report.Len() != 0 {
+		t.Errorf("reportMissing() = %d, %q, want 0 and no report", code,
+			report.String())
+	}
+}
+
+// Checks that -faults reports faulted, alarmed and missing sensors, though
+// not those of the baseline that are merely filtered out.
+func TestReportFaults(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "k10temp\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "45000\n",
+		"/sys/class/hwmon/hwmon1/name":        "nct6798\n",
+		"/sys/class/hwmon/hwmon1/temp1_input": "35000\n",
+		"/sys/class/hwmon/hwmon1/temp1_alarm": "1\n",
+		"/sys/class/hwmon/hwmon1/temp2_input": "-128000\n",
+		"/sys/class/hwmon/hwmon1/temp2_fault": "1\n",
+	})
+
+	path, values, device := baselinePath, baselineValues, deviceFilter
+	number := numberFilter
+	t.Cleanup(func() {
+		baselinePath, baselineValues, deviceFilter = path, values, device
+		numberFilter = number
+	})
+
+	baselinePath = "baseline.txt"
+	baselineValues = map[string]int{
+		"k10temp temp1": 45,
+		"nct6798 temp1": 35,
+		"nvme temp1":    38,
+	}
+
+	tests := []struct {
+		device string
+		code   int
+		report string
+	}{
+		{"", critExitCode, "missing: nvme temp1\nalarm: nct6798 temp1\n" +
+			"fault: nct6798 temp2\n"},
+		{"k10temp", critExitCode, "missing: nvme temp1\n"},
+	}
+
+	for _, test := range tests {
+
+		deviceFilter = test.device
+
+		var report bytes.Buffer
+		code := reportFaults(&report)
+
+		if code != test.code || report.String() != test.report {
+			t.Errorf("-device %q: reportFaults() = %d, %q, want %d, %q",
+				test.device, code, report.String(), test.code, test.report)
+		}
+	}
+
+	// Without the missing and faulted sensors, an alarm alone is only a
+	// warning.
+	delete(baselineValues, "nvme temp1")
+	deviceFilter, numberFilter = "nct6798", 1
+
+	var report bytes.Buffer
+	code := reportFaults(&report)
+	want := "alarm: nct6798 temp1\n"
+	if code != warnExitCode || report.String() != want {
+		t.Errorf("reportFaults() = %d, %q, want %d, %q", code,
+			report.String(), warnExitCode, want)
+	}
+}
+
+// Checks that a baseline saved in one -unit is compared against a scan in
+// another, whether saved as text or as -json output.
+func TestBaselineUnits(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "nvme\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "45000\n",
+		"/sys/class/hwmon/hwmon0/fan1_input":  "1200\n",
+	})
+
+	unit, style := temperatureUnit, unitStyle
+	t.Cleanup(func() { temperatureUnit, unitStyle = unit, style })
+
+	// Save the baseline as both text and JSON, in every unit.
+	saved := make(map[string]string)
+	for _, temperatureUnit = range []string{"C", "F", "K"} {
+
+		path := filepath.Join(t.TempDir(), "baseline.txt")
+		if err := saveBaselineFile(path); err != nil {
+			t.Fatalf("-unit %s: saveBaselineFile() error = %v",
+				temperatureUnit, err)
+		}
+		saved[temperatureUnit+" text"] = path
+
+		devices, err := ScanDevices()
+		if err != nil {
+			t.Fatalf("ScanDevices() error = %v", err)
+		}
+
+		for _, unitStyle = range []string{"standard", "long"} {
+			var output bytes.Buffer
+			if err := printJSON(&output, devices); err != nil {
+				t.Fatalf("printJSON() error = %v", err)
+			}
+			saved[temperatureUnit+" "+unitStyle+" json"] = writeConfigFile(t,
+				output.String())
+		}
+		unitStyle = "standard"
+	}
+
+	contents, err := ioutil.ReadFile(saved["F text"])
+	if err != nil ||
+		string(contents) != "nvme temp1 113 F\nnvme fan1 1200 RPM\n" {
+		t.Errorf("-unit F saved %q, %v, want the unit of each sensor",
+			contents, err)
+	}
+
+	// Whichever unit a baseline was saved in, the same temperature loads.
+	want := map[string]int{"C": 45, "F": 113, "K": 318}
+	for _, temperatureUnit = range []string{"C", "F", "K"} {
+		for name, path := range saved {
+
+			baseline, err := loadBaselineFile(path)
+			if err != nil {
+				t.Fatalf("%s: loadBaselineFile() error = %v", name, err)
+			}
+
+			if baseline["nvme temp1"] != want[temperatureUnit] ||
+				baseline["nvme fan1"] != 1200 {
+				t.Errorf("-unit %s: loadBaselineFile() of %s = %v, want "+
+					"%d and 1200", temperatureUnit, name, baseline,
+					want[temperatureUnit])
+			}
+		}
+	}
+
+	// Baselines saved before the unit was recorded are in Celsius.
+	temperatureUnit = "F"
+	baseline, err := loadBaselineFile(writeConfigFile(t,
+		"nvme temp1 45\nnvme fan1 1200\n"))
+	if err != nil || baseline["nvme temp1"] != 113 ||
+		baseline["nvme fan1"] != 1200 {
+		t.Errorf("loadBaselineFile() of a unitless baseline = %v, %v, want "+
+			"113 and 1200", baseline, err)
+	}
+
+	_, err = loadBaselineFile(writeConfigFile(t, "nvme temp1 45 R\n"))
+	if err == nil {
+		t.Errorf("loadBaselineFile() of an unknown unit error = nil, want one")
+	}
+}
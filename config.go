@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Settings of a single sensor, as given by the -config file.
+type sensorConfig struct {
+
+	// temperature, in degrees Celsius, at or above which the sensor trips
+	// the threshold check; 0 means the -threshold flag applies instead
+	threshold int
+
+	// friendly label to show in place of the driver's one, if not blank
+	label string
+}
+
+// Settings of a single sensor, as written in the -config file.
+type sensorConfigTable struct {
+	Threshold int    `toml:"threshold"`
+	Label     string `toml:"label"`
+}
+
+//! Loads a TOML file of per-sensor thresholds and labels.
+/*
+ * Each sensor is a table named by its device and sensor, as used by the
+ * baseline file, holding any of a threshold and a label; for example
+ *
+ *     [k10temp.temp1]
+ *     threshold = 85
+ *     label = "CPU die"
+ *
+ * Device names containing dots need quoting, e.g. ["nct6775.656".temp1].
+ *
+ * @param      string                     path of the config file
+ *
+ * @returns    map[string]sensorConfig    settings, keyed by sensor identity
+ *             error                      error message, if any
+ */
+func loadConfigFile(path string) (map[string]sensorConfig, error) {
+
+	configs := make(map[string]sensorConfig)
+
+	var devices map[string]map[string]sensorConfigTable
+
+	metadata, err := toml.DecodeFile(path, &devices)
+	if err != nil {
+		return configs, fmt.Errorf("loadConfigFile(): unable to parse "+
+			"%s, %v", path, err)
+	}
+
+	// Misspelt settings would otherwise be silently ignored.
+	if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+		return configs, fmt.Errorf("loadConfigFile(): unknown setting %s "+
+			"in %s", undecoded[0], path)
+	}
+
+	for device, sensors := range devices {
+		for sensor, table := range sensors {
+
+			key := device + "." + sensor
+
+			if !metadata.IsDefined(device, sensor, "threshold") &&
+				!metadata.IsDefined(device, sensor, "label") {
+				return configs, fmt.Errorf("loadConfigFile(): %s in %s has "+
+					"neither a threshold nor a label", key, path)
+			}
+
+			if metadata.IsDefined(device, sensor, "threshold") &&
+				table.Threshold == 0 {
+				return configs, fmt.Errorf("loadConfigFile(): invalid "+
+					"threshold of %s in %s", key, path)
+			}
+
+			if metadata.IsDefined(device, sensor, "label") &&
+				strings.TrimSpace(table.Label) == "" {
+				return configs, fmt.Errorf("loadConfigFile(): blank label "+
+					"of %s in %s", key, path)
+			}
+
+			configs[device+" "+sensor] = sensorConfig{
+				threshold: table.Threshold,
+				label:     table.Label,
+			}
+		}
+	}
+
+	return configs, nil
+}
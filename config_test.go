@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Writes a config file of the given contents, for the rest of the test.
+func writeConfigFile(t *testing.T, contents string) string {
+
+	path := filepath.Join(t.TempDir(), "tempchk.toml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// Checks that thresholds and labels are keyed by the sensor identity.
+func TestLoadConfigFile(t *testing.T) {
+
+	path := writeConfigFile(t, `# per-sensor settings
+[k10temp.temp1]
+threshold = 85
+label = "CPU die"
+
+[nvme.temp1]
+threshold = 70
+
+["nct6775.656".temp7]
+label = "VRM"
+`)
+
+	configs, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigFile() error = %v", err)
+	}
+
+	want := map[string]sensorConfig{
+		"k10temp temp1":     {threshold: 85, label: "CPU die"},
+		"nvme temp1":        {threshold: 70},
+		"nct6775.656 temp7": {label: "VRM"},
+	}
+
+	if len(configs) != len(want) {
+		t.Errorf("loadConfigFile() = %+v, want %+v", configs, want)
+	}
+	for key, config := range want {
+		if configs[key] != config {
+			t.Errorf("loadConfigFile()[%q] = %+v, want %+v", key,
+				configs[key], config)
+		}
+	}
+}
+
+// Checks that malformed and misspelt config files are rejected.
+func TestLoadConfigFileErrors(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{"malformed", "[k10temp.temp1\nthreshold = 85\n"},
+		{"unknown setting", "[k10temp.temp1]\nthreshhold = 85\n"},
+		{"no settings", "[k10temp.temp1]\n"},
+		{"zero threshold", "[k10temp.temp1]\nthreshold = 0\n"},
+		{"blank label", "[k10temp.temp1]\nlabel = \" \"\n"},
+		{"wrong type", "[k10temp.temp1]\nthreshold = \"hot\"\n"},
+	}
+
+	for _, test := range tests {
+
+		_, err := loadConfigFile(writeConfigFile(t, test.contents))
+		if err == nil {
+			t.Errorf("%s: loadConfigFile() error = nil, want one", test.name)
+		}
+	}
+
+	_, err := loadConfigFile(filepath.Join(t.TempDir(), "missing"))
+	if err == nil {
+		t.Errorf("loadConfigFile() of a missing file error = nil, want one")
+	}
+}
+
+// Checks that tempchk exits with an error, rather than running without the
+// settings, when the -config file cannot be parsed.
+func TestConfigParseErrorExits(t *testing.T) {
+
+	// Within the child process, run tempchk itself.
+	if path := os.Getenv("TEMPCHK_TEST_CONFIG"); path != "" {
+		os.Args = []string{"tempchk", "-hwmon-dir", t.TempDir() + "/",
+			"-config", path}
+		main()
+		return
+	}
+
+	path := writeConfigFile(t, "[k10temp.temp1\nthreshold = 85\n")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestConfigParseErrorExits$")
+	cmd.Env = append(os.Environ(), "TEMPCHK_TEST_CONFIG="+path)
+	output, err := cmd.CombinedOutput()
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("tempchk -config exited with %v, want exit code 1; "+
+			"output:\n%s", err, output)
+	}
+
+	if !strings.Contains(string(output), "unable to parse "+path) {
+		t.Errorf("tempchk -config printed %q, want the parse error", output)
+	}
+}
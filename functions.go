@@ -1,16 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
-	"strings"
+	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rbisewski/tempchk/pkg/tempchk"
 )
 
 //! Function to handle printing debug messages when debug mode is on.
 /*
- * @param      string    message to print to stdout
+ * @param      string    message to log to stderr
  *
  * @returns    none
  */
@@ -27,188 +35,1218 @@ func debug(debugMsg string) {
 	}
 
 	// Trim away unneeded whitespace.
-	debugMsg = strings.Trim(debugMsg, " ")
+	debugMsg = strings.Trim(debugMsg, " \n")
 
 	// Sanity check, make sure the pre-Trim'd string wasn't just whitespace.
 	if len(debugMsg) < 1 {
 		return
 	}
 
-	// Since this got a non-blank string, go ahead and print it to stdout.
-	fmt.Println(debugMsg)
+	// Since this got a non-blank string, go ahead and log it; this goes to
+	// stderr, so that it never mixes with the sensor output.
+	debugLogger.Println(debugMsg)
 }
 
-//! Obtains hwmon sensor data.
+//! Resolves a symlink chain, following at most the given number of links.
 /*
- * @param      string    name of device
- * @param      string    full path of the given hwmon directory
+ * @param      string    path to resolve
+ * @param      int       maximum number of symlinks to follow
  *
- * @returns    Sensor    sensor data object
- *             error     whether or not the output is feasible
+ * @returns    string    final, non-symlink path
+ *             error     whether or not the path could be resolved
  */
-func GetSensorData(name string, hwmon string) ([]Sensor, error) {
+func resolveSymlink(path string, depth int) (string, error) {
 
-        sensors := make([]Sensor, 0)
+	// input validation
+	if path == "" || depth < 0 {
+		return "", fmt.Errorf("resolveSymlink(): invalid input")
+	}
 
-        // input validation
-        if name == "" || hwmon == "" {
-                return sensors, fmt.Errorf("GetSensorData(): invalid input")
-        }
+	for hops := 0; ; hops++ {
 
-        // figure out the total number of sensors a given device has
-        count := 1
-        for {
-	        // Assemble the filepath to the temperature file of the currently
-	        // given hardware device.
-	        path := hardwareMonitorDirectory + hwmon + "/" +
-                        tempPrefix + strconv.Itoa(count) + inputSuffix
+		info, err := tempchk.DefaultFileSystem.Lstat(path)
+		if err != nil {
+			return "", err
+		}
 
-	        rawData, err := ioutil.ReadFile(path)
-	        if err != nil || len(rawData) < 1 {
-                        count--
-                        break
-	        }
+		// Once a non-symlink is reached, the chain is fully resolved.
+		if info.Mode()&os.ModeSymlink == 0 {
+			return path, nil
+		}
 
-                count++
-        }
+		if hops >= depth {
+			return "", fmt.Errorf("resolveSymlink(): symlink depth "+
+				"limit of %d reached at %s", depth, path)
+		}
 
-        for i := 1; i <= count; i++ {
+		target, err := tempchk.DefaultFileSystem.Readlink(path)
+		if err != nil {
+			return "", err
+		}
 
-	        // Assemble the filepath to the temperature file of the currently
-	        // given hardware device.
-	        path := hardwareMonitorDirectory + hwmon + "/" +
-                        tempPrefix + strconv.Itoa(i) + inputSuffix
+		// Relative links are relative to the directory holding the link.
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
 
-	        debug("Opening " + hwmon + " file at:\n" + path)
+		path = target
+	}
+}
 
-	        rawData, err := ioutil.ReadFile(path)
-	        if err != nil || len(rawData) < 1 {
-                        break
-	        }
+//! Determines whether a hwmon entry resolves within the symlink depth limit.
+/*
+ * @param      string    name of the hwmon entry, e.g. hwmon0
+ *
+ * @returns    bool      whether or not the entry is safe to read
+ */
+func hwmonEntryResolves(hwmon string) bool {
 
-	        debug("Converting temperature file data from " +
-	            hwmon + " into a string.")
+	resolved, err := resolveSymlink(tempchk.HardwareMonitorDirectory+hwmon,
+		followSymlinkDepth)
 
-	        // Attempt to convert the temperature to a string, trim it, and then
-	        // to an integer value afterwards.
-	        trimmedIntData, err := strconv.Atoi(strings.Trim(string(rawData), " \n"))
-	        if err != nil || trimmedIntData < 1 {
-                        continue
-	        }
+	if err != nil {
+		debug("Warning: " + hwmon + " could not be resolved: " +
+			err.Error() + ". Skipping...")
+		return false
+	}
 
-                sensor := Sensor{
-                       name: name,
-                       path: path,
-                       category: tempPrefix,
-                       intData: trimmedIntData,
-                       number: i,
-                       count: count,
-                }
+	debug(hwmon + " resolves to " + resolved)
 
-                sensors = append(sensors, sensor)
-        }
+	return true
+}
+
+//! Determines the stable name of a hwmon device, via its device symlink.
+/*
+ * The hwmonN numbering depends on the order the drivers were loaded in,
+ * whereas the device the hwmon entry belongs to, e.g. a PCI function,
+ * does not change across reboots.
+ *
+ * @param      string    hwmon directory of the device, e.g. hwmon0
+ *
+ * @returns    string    bus identifier of the device, e.g. 0000:00:18.3,
+ *                       or blank if the entry has no device symlink
+ */
+func stableDeviceName(hwmon string) string {
 
-        if len(sensors) == 0 {
-                return sensors, fmt.Errorf("GetSensorData(): no valid sensors")
-        }
+	// The link points straight at the device, e.g. ../../../0000:00:18.3,
+	// so its last element is the identifier.
+	target, err := tempchk.DefaultFileSystem.Readlink(
+		tempchk.HardwareMonitorDirectory + hwmon + "/device")
+	if err != nil {
+		debug("Warning: " + hwmon + " has no device symlink, so it keeps " +
+			"its hwmon name")
+		return ""
+	}
 
-        return sensors, nil
+	return filepath.Base(target)
 }
 
-// SetGlobalSensorFlags ... alters how Linux sees temperatures
+//! Determines which identifier of a device to print.
 /*
- * @param    os.FileInfo[]    array of directory data
+ * @param      Device    device to identify
  *
- * @return   error            error message, if any
+ * @returns    string    stable name of the device if requested and known,
+ *                       else its hwmon directory, e.g. hwmon0
  */
-func SetGlobalSensorFlags(dirs []os.FileInfo) error {
+func deviceID(device Device) string {
 
-	// input validation
-	if dirs == nil || len(dirs) < 1 {
-		return fmt.Errorf("SetGlobalSensorFlags(): invalid input")
+	if device.stableName != "" {
+		return device.stableName
 	}
 
-	// Cycle thru the entire list of device directories...
-	for _, dir := range dirs {
+	return device.hwmon
+}
+
+//! Trims a device name, and canonicalizes its casing if requested.
+/*
+ * @param      string    raw device name, e.g. from a hwmon name file
+ *
+ * @returns    string    name to use for both matching and display
+ */
+func normalizeName(name string) string {
+
+	if !normalizeNames {
+		return strings.TrimSpace(name)
+	}
+
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+//! Determines whether a device name matches the -filter globs, if any.
+/*
+ * @param      string    name of the device, e.g. k10temp
+ *
+ * @returns    bool      whether or not the device was requested
+ */
+func deviceNameMatches(name string) bool {
+
+	if deviceNameFilter == "" {
+		return true
+	}
+
+	for _, pattern := range strings.Split(deviceNameFilter, ",") {
+
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+
+		matched, err := path.Match(pattern, strings.ToLower(name))
+		if err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+//! Determines whether a sensor label matches the label filter, if any.
+/*
+ * @param      string    label of the sensor, which may be blank
+ *
+ * @returns    bool      whether or not the sensor was requested
+ */
+func labelMatches(label string) bool {
+
+	if labelFilter == "" {
+		return true
+	}
+
+	// Both "AUXTIN" and "AUXTIN*" select every AUXTIN sensor.
+	prefix := strings.TrimSuffix(labelFilter, "*")
+
+	return label != "" && strings.HasPrefix(label, prefix)
+}
+
+//! Describes the PWM duty and control mode of a fan, if it has them.
+/*
+ * @param      Device    device of the fan
+ * @param      Sensor    fan sensor to describe
+ *
+ * @returns    string    e.g. "   pwm 40% (automatic)", or blank if the fan
+ *                       has no PWM file
+ */
+func fanControl(device Device, sensor tempchk.Sensor) string {
+
+	percent, err := tempchk.ReadFanPWM(device.hwmon, sensor.Number)
+	if err != nil {
+		debug("Warning: " + device.hwmon + " has no pwm" +
+			strconv.Itoa(sensor.Number) + " for its fan" +
+			strconv.Itoa(sensor.Number))
+		return ""
+	}
+
+	description := "   pwm " + strconv.Itoa(percent) + "%"
+
+	// Some drivers expose the duty cycle, but not who is setting it.
+	mode, err := tempchk.ReadFanControlMode(device.hwmon, sensor.Number)
+	if err == nil {
+		description += " (" + mode + ")"
+	}
+
+	return description
+}
+
+//! Splits a -ignore specifier into its device and sensor.
+/*
+ * @param      string    specifier, e.g. nct6799:temp7
+ *
+ * @returns    string    name of the device, e.g. nct6799
+ *             string    number or label of the sensor, e.g. temp7
+ *             bool      whether or not both halves are present
+ */
+func splitIgnoreSpecifier(specifier string) (string, string, bool) {
+
+	i := strings.Index(specifier, ":")
+	if i < 0 {
+		return "", "", false
+	}
+
+	device := strings.TrimSpace(specifier[:i])
+	sensor := strings.TrimSpace(specifier[i+1:])
+
+	return device, sensor, device != "" && sensor != ""
+}
+
+//! Determines whether a sensor was left out via the -ignore flag.
+/*
+ * @param      string    name of the device of the sensor
+ * @param      Sensor    sensor to check, with its friendly label, if any
+ *
+ * @returns    bool      whether or not the sensor is to be left out
+ */
+func sensorIgnored(name string, sensor tempchk.Sensor) bool {
+
+	if len(ignoredSensors) == 0 {
+		return false
+	}
+
+	number := sensor.Category + strconv.Itoa(sensor.Number)
+	if ignoredSensors[strings.ToLower(name+":"+number)] {
+		return true
+	}
+
+	return sensor.Label != "" &&
+		ignoredSensors[strings.ToLower(name+":"+sensor.Label)]
+}
+
+//! Determines the fixed-point divisor of a sensor of a given chip.
+/*
+ * @param      string    name of the chip, e.g. nct6798
+ * @param      string    sensor category, e.g. temp or fan
+ *
+ * @returns    int       divisor to apply, preferring any user override
+ */
+func sensorDivisor(chip string, category string) int {
+
+	divisor, ok := scaleOverrides[chip+":"+category]
+	if ok {
+		return divisor
+	}
+
+	return tempchk.CategoryDivisor(category)
+}
+
+//! Loads a file of per-chip divisor overrides.
+/*
+ * Each line of the file maps a chip and category to a divisor, e.g.
+ * "nct6798:in=1000", with blank lines and # comments being ignored. The
+ * category must be one that tempchk knows the unit of.
+ *
+ * @param      string            path of the override file
+ *
+ * @returns    map[string]int    divisors, keyed by chip:category
+ *             error             error message, if any
+ */
+func loadScaleOverrides(path string) (map[string]int, error) {
+
+	overrides := make(map[string]int)
+
+	rawData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return overrides, fmt.Errorf("loadScaleOverrides(): unable to read %s",
+			path)
+	}
+
+	for i, line := range strings.Split(string(rawData), "\n") {
+
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
 
-		// Assemble the filepath to the name file of the currently given
-		// hardware device.
-		hardwareNameFilepathOfGivenDevice := hardwareMonitorDirectory +
-			dir.Name() + "/" + hardwareNameFile
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || !strings.Contains(parts[0], ":") {
+			return overrides, fmt.Errorf("loadScaleOverrides(): malformed "+
+				"line %d in %s", i+1, path)
+		}
+
+		// A misspelt category would otherwise never be consulted.
+		key := strings.TrimSpace(parts[0])
+		category := key[strings.LastIndex(key, ":")+1:]
+		if _, ok := unitStyles["standard"][category]; !ok {
+			return overrides, fmt.Errorf("loadScaleOverrides(): unknown "+
+				"category %s on line %d in %s", category, i+1, path)
+		}
+
+		divisor, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || divisor < 1 {
+			return overrides, fmt.Errorf("loadScaleOverrides(): invalid "+
+				"divisor on line %d in %s", i+1, path)
+		}
+
+		overrides[key] = divisor
+	}
+
+	return overrides, nil
+}
+
+//! Determines the unit text of a given sensor category.
+/*
+ * @param      string    sensor category, e.g. temp or fan
+ *
+ * @returns    string    unit in the current unit style, or blank if unknown
+ */
+func categoryUnit(category string) string {
+
+	if category == tempchk.TempPrefix && temperatureUnit != "C" {
+		if unitStyle == "long" {
+			return temperatureUnitNames[temperatureUnit]
+		}
+		return temperatureUnit
+	}
+
+	return unitStyles[unitStyle][category]
+}
+
+//! Determines the color band of a given temperature.
+/*
+ * @param      int       temperature, in the unit given by the -unit flag
+ *
+ * @returns    string    ANSI escape sequence of the color; green, yellow
+ *                       once warm, or red once hot
+ */
+func temperatureColor(value int) string {
+
+	if value >= convertTemperature(hotTemperature) {
+		return "\033[31m"
+	}
+
+	if value >= convertTemperature(warmTemperature) {
+		return "\033[33m"
+	}
+
+	return "\033[32m"
+}
+
+//! Determines whether or not to color the printed output.
+/*
+ * @returns    bool    whether or not to color, as per the -color flag;
+ *                     in auto mode, only if the output is a terminal
+ */
+func useColor() bool {
+
+	switch colorMode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+
+	file, ok := outputWriter.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+//! Converts a temperature from the requested unit back into Celsius.
+/*
+ * @param      int    temperature, in the unit given by the -unit flag
+ *
+ * @returns    int    temperature, in degrees Celsius
+ */
+func celsiusTemperature(value int) int {
+
+	switch temperatureUnit {
+	case "F":
+		return (value - 32) * 5 / 9
+	case "K":
+		return int(math.Round(float64(value) - kelvinOffset))
+	}
+
+	return value
+}
+
+//! Determines how much of its rated maximum a temperature sensor is at.
+/*
+ * @param      Sensor    sensor to check
+ *
+ * @returns    int       current value as a percentage of the max limit,
+ *                       as compared in degrees Celsius
+ *             bool      whether or not the sensor has a usable max limit
+ */
+func headroomPercent(sensor tempchk.Sensor) (int, bool) {
+
+	if sensor.Category != tempchk.TempPrefix {
+		return 0, false
+	}
+
+	limit, ok := sensor.Limits[tempchk.MaxSuffix]
+	if !ok {
+		return 0, false
+	}
+
+	maximum := celsiusTemperature(limit)
+	if maximum <= 0 {
+		return 0, false
+	}
 
-		// If debug mode, print out the current 'name' file we are about
-		// to open.
-		debug(dir.Name() + " --> " +
-			hardwareNameFilepathOfGivenDevice)
+	return celsiusTemperature(sensor.IntData) * 100 / maximum, true
+}
+
+//! Converts a temperature from Celsius into the requested unit.
+/*
+ * @param      int    temperature, in degrees Celsius
+ *
+ * @returns    int    temperature, in the unit given by the -unit flag
+ */
+func convertTemperature(celsius int) int {
+
+	switch temperatureUnit {
+	case "F":
+		return celsius*9/5 + 32
+	case "K":
+		return int(math.Round(float64(celsius) + kelvinOffset))
+	}
+
+	return celsius
+}
+
+//! Determines the temperature of a sensor, keeping the fractional degree.
+/*
+ * @param      Sensor     scaled and corrected temperature sensor
+ *
+ * @returns    float64    temperature, in the unit given by the -unit flag
+ */
+func preciseTemperature(sensor tempchk.Sensor) float64 {
+
+	if sensor.Divisor < 1 {
+		return float64(sensor.IntData)
+	}
 
-		// ...check to see if a 'name' file is present inside the directory.
-		nameValueOfHardwareDevice, err := ioutil.ReadFile(
-			hardwareNameFilepathOfGivenDevice)
+	celsius := float64(sensor.RawData) / float64(sensor.Divisor)
 
-		// If err is not nil, skip this device.
+	// The corrections only take whole degrees, so apply them as an offset.
+	if !noCorrections {
+		whole := int(celsius)
+		celsius += float64(sensorCorrections().CorrectTemperature(
+			sensor.Name, whole) - whole)
+	}
+
+	switch temperatureUnit {
+	case "F":
+		return celsius*9/5 + 32
+	case "K":
+		return celsius + kelvinOffset
+	}
+
+	return celsius
+}
+
+//! Formats the value of a sensor, to the decimals given by -round.
+/*
+ * @param      Sensor    scaled and corrected sensor
+ *
+ * @returns    float64   value, with a fraction only if it has a meaningful one
+ *             string    value as printed, e.g. 45 or 42.9
+ */
+func sensorValue(sensor tempchk.Sensor) (float64, string) {
+
+	// Fans and the like stay whole, no matter the -round flag.
+	if sensor.Category != tempchk.TempPrefix || roundDecimals < 1 {
+		return sensor.Value(), sensor.FormatValue()
+	}
+
+	value := preciseTemperature(sensor)
+	text := strconv.FormatFloat(value, 'f', roundDecimals, 64)
+	rounded, _ := strconv.ParseFloat(text, 64)
+
+	return rounded, text
+}
+
+//! Scans the hwmon directory and reads the sensors of every device.
+/*
+ * @returns    Device[]    devices found, in directory order
+ *             error       whether or not the scan is feasible; if the scan
+ *                         deadline is exceeded, the devices that finished
+ *                         reading are returned along with errScanDeadline
+ */
+func ScanDevices() ([]Device, error) {
+
+	devices := make([]Device, 0)
+
+	// normally there will likely be at least one sensor exposed to
+	// the operating system; however, in theory there could be edge cases
+	// where there are no sensors, so account for that here
+	listOfDeviceDirs, err := tempchk.DefaultFileSystem.ReadDir(
+		tempchk.HardwareMonitorDirectory)
+
+	// Some VMs and containers lack the hwmon directory altogether, yet
+	// still have thermal zones, which are then read instead.
+	if err != nil && len(namedThermalZones()) == 0 {
+		return devices, fmt.Errorf("ScanDevices(): %w",
+			tempchk.NewCausedError(tempchk.ErrHwmonNotFound,
+				"unable to read "+tempchk.HardwareMonitorDirectory, err))
+	}
+	if err != nil {
+		debug("Warning: unable to read " + tempchk.HardwareMonitorDirectory +
+			", so only the thermal zones are read")
+		listOfDeviceDirs = nil
+	}
+
+	// Debug mode, print out a list of files in the directory specified by
+	// the "tempchk.HardwareMonitorDirectory" global variable.
+	if debugMode {
+
+		debug("The following IDs are present in the hardware sensor " +
+			"monitoring directory:\n")
+
+		for _, dir := range listOfDeviceDirs {
+			debug("* " + dir.Name())
+		}
+	}
+
+	// Devices may come and go between scans, e.g. when hotplugged.
+	deviceNames.prune(listOfDeviceDirs)
+
+	// Search thru the directories and set the relevant flags; there may be
+	// none at all, in which case the thermal zones are read instead.
+	if len(listOfDeviceDirs) > 0 {
+		err = SetGlobalSensorFlags(listOfDeviceDirs)
 		if err != nil {
+			return devices, err
+		}
+	}
+
+	// Bound the whole scan, if requested, so that a monitoring cycle is
+	// never blocked indefinitely by a misbehaving sensor.
+	ctx := context.Background()
+	if scanDeadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, scanDeadline)
+		defer cancel()
+	}
+
+	// Work out which devices to read first, so that they can then all be
+	// read at once; the order of this slice is the order of the output.
+	pending := listDevices(listOfDeviceDirs)
+
+	// Some boards and VMs only expose their temperatures as thermal zones.
+	if readThermalZones || len(pending) == 0 {
+		pending = append(pending, listThermalZones()...)
+	}
+
+	// Read every device in its own goroutine, so that many slow sensor
+	// files are read in parallel, and a hung one cannot hold up the scan
+	// past its deadline; once that passes, the goroutines give up on the
+	// rest of their reads too, rather than reading on unseen.
+	results := make(chan deviceSensors, len(pending))
+	for i, device := range pending {
+		go func(index int, name string, hwmon string) {
+			sensors, err := sampleDeviceSensors(ctx, name, hwmon)
+			results <- deviceSensors{
+				index:   index,
+				sensors: sensors,
+				err:     err,
+			}
+		}(i, device.name, device.hwmon)
+	}
+
+	// Slot each result back into place, so the output order stays the same
+	// regardless of which device finished first.
+	sensorsRead := make([][]tempchk.Sensor, len(pending))
+	readErrors := make([]error, len(pending))
+	finished := make([]bool, len(pending))
+	deadlineExceeded := false
+
+	for remaining := len(pending); remaining > 0 && !deadlineExceeded; remaining-- {
+		select {
+		case result := <-results:
+			sensorsRead[result.index] = result.sensors
+			readErrors[result.index] = result.err
+			finished[result.index] = true
+		case <-ctx.Done():
+			deadlineExceeded = true
+		}
+	}
 
-			// If debug mode, then print out a message telling the user
-			// which device is missing a hardware 'name' file.
-			debug("Warning: " + dir.Name() + " does not contain a " +
-				"hardware name file. Skipping...")
+	for i, device := range pending {
 
-			// Move on to the next device.
+		if !finished[i] {
+			debug("Warning: the scan deadline was exceeded while " +
+				"reading " + device.hwmon)
 			continue
 		}
 
-		// If the hardware name file does not contain anything of value,
-		// skip it and move on to the next device.
-		if len(nameValueOfHardwareDevice) < 1 {
+		sensors := sensorsRead[i]
 
-			// If debug mode, then print out a message telling the user
-			// which device is missing a hardware 'name' file.
-			debug("Warning: The hardware name file of " + dir.Name() +
-				" does not contain valid data. Skipping...")
+		// If there are no sensors, then the temperature file does not have
+		// valid integer data, so the device is kept but without any sensors.
+		if len(sensors) < 1 {
 
-			// Move on to the next device.
+			debug("Warning: " + device.hwmon + " does not contain " +
+				"valid sensor data in the hardware input file, " +
+				"ergo no temperature data to print for this device.")
+
+			device.err = readErrors[i]
+			devices = append(devices, device)
+			continue
+		}
+
+		if mergeDuplicateSensors {
+			sensors = tempchk.MergeDuplicateSensors(sensors)
+		}
+
+		for _, sensor := range sensors {
+
+			// Skip any sensors that were not requested by the end-user.
+			if numberFilter >= 0 && (sensor.Number != numberFilter ||
+				sensor.Category != numberCategory) {
+				continue
+			}
+
+			if !labelMatches(sensor.Label) {
+				continue
+			}
+
+			// Show the friendly label from the config file, if any.
+			config, ok := sensorConfigs[sensor.Name+" "+sensor.Category+
+				strconv.Itoa(sensor.Number)]
+			if ok && config.label != "" {
+				sensor.Label = config.label
+			}
+
+			// Ignore after the label is resolved, so that either the
+			// driver label or the friendly one may be used.
+			if sensorIgnored(device.name, sensor) {
+				debug("Ignoring " + device.hwmon + " " + sensor.Category +
+					strconv.Itoa(sensor.Number) + ", as per -ignore")
+				continue
+			}
+
+			// Usually hardware sensors uses 3-sigma of precision and stores
+			// the value as an integer for purposes of simplicity.
+			//
+			// Ergo, this needs to be divided by the category's scale to
+			// give values that are meaningful to humans.
+			//
+			divisor := sensorDivisor(sensor.Name, sensor.Category)
+			sensor = tempchk.ScaleSensor(sensor, divisor)
+
+			// Averages are rounded to the nearest unit, rather than
+			// truncated, since they are not exact readings anyway.
+			if sampleCount > 1 {
+				sensor.IntData = int(math.Round(float64(sensor.RawData) /
+					float64(divisor)))
+			}
+
+			// Some drivers report temperatures that need correcting, e.g.
+			// k10temp on older kernels; the limits are corrected alike.
+			if !noCorrections {
+				sensor = sensorCorrections().CorrectSensor(sensor)
+			}
+
+			// Flag readings no real sensor would give, e.g. 500 C, or
+			// drop them entirely if in strict mode.
+			sensor.Implausible = !tempchk.PlausibleTemperature(sensor)
+			if sensor.Implausible {
+				debug("Warning: " + device.hwmon + " reported an " +
+					"implausible " + sensor.Category +
+					strconv.Itoa(sensor.Number) + " of " +
+					strconv.Itoa(sensor.IntData) + " C")
+				if strictMode {
+					continue
+				}
+			}
+
+			// Convert only once the Celsius value has been corrected; the
+			// limits are converted too, so they stay comparable.
+			if sensor.Category == tempchk.TempPrefix {
+				sensor.IntData = convertTemperature(sensor.IntData)
+				for suffix, limit := range sensor.Limits {
+					sensor.Limits[suffix] = convertTemperature(limit)
+				}
+			}
+
+			device.sensors = append(device.sensors, sensor)
+		}
+
+		// If every sensor was filtered away, the device was not requested.
+		if len(device.sensors) < 1 {
+			continue
+		}
+
+		devices = append(devices, device)
+	}
+
+	if deadlineExceeded {
+		return devices, errScanDeadline
+	}
+
+	return devices, nil
+}
+
+//! Reads the name of a hwmon device, as per its hardware name file.
+/*
+ * @param      os.FileInfo    entry of the hwmon directory, e.g. hwmon0
+ *
+ * @returns    string         trimmed name of the device, e.g. k10temp
+ *             bool           whether or not the device has a valid name
+ */
+func readDeviceName(dir os.FileInfo) (string, bool) {
+
+	// Assemble the filepath to the name file of the currently given
+	// hardware device.
+	hardwareNameFilepathOfGivenDevice := tempchk.HardwareMonitorDirectory +
+		dir.Name() + "/" + tempchk.HardwareNameFile
+
+	// If debug mode, print out the current 'name' file we are about
+	// to open.
+	debug(dir.Name() + " --> " +
+		hardwareNameFilepathOfGivenDevice)
+
+	// ...check to see if a 'name' file is present inside the directory.
+	nameValueOfHardwareDevice, err := tempchk.ReadNameFile(
+		tempchk.HardwareMonitorDirectory, dir.Name())
+
+	// If err is not nil, the device cannot be used.
+	if err != nil {
+
+		// If debug mode, then print out a message telling the user
+		// which device is missing a hardware 'name' file.
+		debug("Warning: " + dir.Name() + " does not contain a " +
+			"hardware name file. Skipping...")
+
+		return "", false
+	}
+
+	// Trim away any excess whitespace from the hardware name file data.
+	name := normalizeName(string(nameValueOfHardwareDevice))
+
+	// If the hardware name file does not contain anything of value,
+	// the device cannot be used either.
+	if name == "" {
+
+		// If debug mode, then print out a message telling the user
+		// which device is missing a hardware 'name' file.
+		debug("Warning: The hardware name file of " + dir.Name() +
+			" does not contain valid data. Skipping...")
+
+		return "", false
+	}
+
+	return name, true
+}
+
+//! Describes why a device has no sensors, as shown beside its N/A.
+/*
+ * @param      error     error of reading the device
+ *
+ * @returns    string    reason, e.g. no input files found
+ */
+func noSensorsReason(err error) string {
+
+	for _, reason := range []error{tempchk.ErrNoInputFiles,
+		tempchk.ErrInputPermission, tempchk.ErrInputUnreadable,
+		tempchk.ErrInputUnparseable} {
+		if errors.Is(err, reason) {
+			return reason.Error()
+		}
+	}
+
+	return err.Error()
+}
+
+//! Lists every device that has a name, without reading their sensors.
+/*
+ * @param      os.FileInfo[]    entries of the hwmon directory
+ *
+ * @returns    Device[]         devices that have a name file, in directory
+ *                              order
+ */
+func namedDevices(dirs []os.FileInfo) []Device {
+
+	devices := make([]Device, 0)
+
+	// For each of the devices...
+	for _, dir := range dirs {
+
+		// Skip any hwmon entries whose symlinks cannot be resolved within
+		// the configured depth, since they are likely malformed or looped.
+		if !hwmonEntryResolves(dir.Name()) {
 			continue
 		}
 
-		// Trim away any excess whitespace from the hardware name file data.
-		nameValueOfHardwareDeviceAsString :=
-			strings.Trim(string(nameValueOfHardwareDevice), " \n")
+		// Skip any devices without a valid hardware name file.
+		trimmedName, ok := deviceNames.lookup(dir)
+		if !ok {
+			continue
+		}
 
-		// Determine the length of the longest entry string
-		//
-		// TODO: this is a less than ideal place for this code, consider
-		//       rewriting how this program handles hwmonX entries at some
-		//       future date
-		//
-		if len(nameValueOfHardwareDeviceAsString) > maxEntryLength {
-			maxEntryLength = len(nameValueOfHardwareDeviceAsString)
+		device := Device{
+			hwmon:   dir.Name(),
+			name:    trimmedName,
+			sensors: make([]tempchk.Sensor, 0),
 		}
 
-		// Conduct a quick check to determine if the 'fam15h_power' module
-		// is currently in use.
-		if nameValueOfHardwareDeviceAsString == "fam15h_power" {
-			digitalAmdPowerModuleInUse = true
+		if stableNames {
+			device.stableName = stableDeviceName(dir.Name())
 		}
+
+		devices = append(devices, device)
 	}
 
-	//
-	// attempt to read from the CPU info file to determine if Ryzen
-	//
+	return devices
+}
 
-	cpuinfoFileAsBytes, err := ioutil.ReadFile(cpuinfoDirectory)
-	if len(cpuinfoFileAsBytes) == 0 || err != nil {
-		return nil
+//! Determines whether a device was requested, as per -device and -filter.
+/*
+ * @param      string    trimmed name of the device, e.g. k10temp
+ *
+ * @returns    bool      whether or not the device was requested
+ */
+func deviceRequested(name string) bool {
+
+	if deviceFilter != "" && name != normalizeName(deviceFilter) {
+		return false
 	}
 
-	cpuinfoString := string(cpuinfoFileAsBytes)
-	if cpuinfoString == "" {
-		return nil
+	return deviceNameMatches(name)
+}
+
+//! Lists the requested devices, by name, without reading their sensors.
+/*
+ * @param      os.FileInfo[]    entries of the hwmon directory
+ *
+ * @returns    Device[]         devices that have a name file and match the
+ *                              device filters, in directory order
+ */
+func listDevices(dirs []os.FileInfo) []Device {
+
+	devices := make([]Device, 0)
+
+	// Skip any devices that were not requested by the end-user.
+	for _, device := range namedDevices(dirs) {
+		if deviceRequested(device.name) {
+			devices = append(devices, device)
+		}
+	}
+
+	return devices
+}
+
+//! Gathers the names of every device and thermal zone, regardless of the
+//! device, label and sensor filters.
+/*
+ * @returns    map[string]bool    trimmed names of the devices present
+ */
+func presentDeviceNames() map[string]bool {
+
+	present := make(map[string]bool)
+
+	// The hwmon directory may be absent, e.g. if there are only zones.
+	dirs, err := tempchk.DefaultFileSystem.ReadDir(
+		tempchk.HardwareMonitorDirectory)
+	if err != nil {
+		debug("Warning: unable to read " + tempchk.HardwareMonitorDirectory)
 	}
 
-	if strings.Contains(cpuinfoString, "Ryzen") {
-		digitalAmdPowerModuleInUse = true
+	for _, device := range append(namedDevices(dirs), namedThermalZones()...) {
+		present[device.name] = true
+	}
+
+	return present
+}
+
+//! Determines whether there are any sensors to read at all, i.e. either a
+//! hwmon directory or any thermal zones.
+/*
+ * @returns    bool    whether or not there is anything to read
+ */
+func sensorsAvailable() bool {
+
+	_, err := tempchk.DefaultFileSystem.ReadDir(
+		tempchk.HardwareMonitorDirectory)
+
+	return err == nil || len(namedThermalZones()) > 0
+}
+
+//! Counts the input files of a category in a device, without reading them.
+/*
+ * @param      string    hwmon directory of the device, e.g. hwmon0
+ * @param      string    sensor category, e.g. temp
+ *
+ * @returns    int       number of sensors of the category detected
+ */
+func countSensorFiles(hwmon string, category string) int {
+
+	files, err := tempchk.DefaultFileSystem.ReadDir(
+		tempchk.HardwareMonitorDirectory + hwmon)
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, file := range files {
+
+		// Only count e.g. temp1_input, and not temp1_max or temp_input.
+		name := file.Name()
+		if !strings.HasPrefix(name, category) ||
+			!strings.HasSuffix(name, tempchk.InputSuffix) {
+			continue
+		}
+
+		number := strings.TrimSuffix(strings.TrimPrefix(name, category),
+			tempchk.InputSuffix)
+		if _, err := strconv.Atoi(number); err == nil {
+			count++
+		}
+	}
+
+	return count
+}
+
+//! Lists every thermal zone that has a type, without reading them.
+/*
+ * @returns    Device[]    thermal zones that have a type, in directory order
+ */
+func namedThermalZones() []Device {
+
+	zones := make([]Device, 0)
+
+	dirs, err := tempchk.DefaultFileSystem.ReadDir(
+		tempchk.ThermalZoneDirectory)
+	if err != nil {
+		debug("Warning: unable to read " + tempchk.ThermalZoneDirectory)
+		return zones
+	}
+
+	for _, dir := range dirs {
+
+		// The directory also lists cooling devices, e.g. cooling_device0.
+		if !strings.HasPrefix(dir.Name(), tempchk.ThermalZonePrefix) {
+			continue
+		}
+
+		zoneType, err := tempchk.ReadThermalZoneType(
+			tempchk.ThermalZoneDirectory, dir.Name())
+		if err != nil || zoneType == "" {
+			debug("Warning: " + dir.Name() + " does not contain a valid " +
+				"type file. Skipping...")
+			continue
+		}
+
+		zones = append(zones, Device{
+			hwmon:   dir.Name(),
+			name:    normalizeName(zoneType),
+			sensors: make([]tempchk.Sensor, 0),
+		})
+	}
+
+	return zones
+}
+
+//! Lists the requested thermal zones, by type, without reading them.
+/*
+ * @returns    Device[]    thermal zones that have a type and match the
+ *                         device filters, in directory order
+ */
+func listThermalZones() []Device {
+
+	zones := make([]Device, 0)
+
+	// Skip any zones that were not requested by the end-user.
+	for _, zone := range namedThermalZones() {
+		if deviceRequested(zone.name) {
+			zones = append(zones, zone)
+		}
+	}
+
+	return zones
+}
+
+//! Reads the sensors of a single device, averaging several samples of each.
+/*
+ * @param      Context     context of the scan, e.g. with its deadline
+ * @param      string      name of the device
+ * @param      string      hwmon directory of the device, e.g. hwmon0
+ *
+ * @returns    Sensor[]    unscaled sensors of the device, the values of
+ *                         which are the average of the -count samples
+ *             error       why the device has no sensors, if it has none
+ */
+func sampleDeviceSensors(ctx context.Context, name string,
+	hwmon string) ([]tempchk.Sensor, error) {
+
+	sensors, err := readDeviceSensors(ctx, name, hwmon)
+	if sampleCount <= 1 || err != nil {
+		return sensors, err
+	}
+
+	// Sum up the samples of each sensor, since a flaky sensor may well be
+	// absent from some of them.
+	totals := make(map[string]int)
+	counts := make(map[string]int)
+	for _, sensor := range sensors {
+		key := sensor.Category + strconv.Itoa(sensor.Number)
+		totals[key] = sensor.RawData
+		counts[key] = 1
+	}
+
+	for i := 1; i < sampleCount; i++ {
+
+		// Once the scan is over, the samples so far have to do.
+		select {
+		case <-ctx.Done():
+			return sensors, ctx.Err()
+		case <-time.After(sampleDelay):
+		}
+
+		samples, _ := readDeviceSensors(ctx, name, hwmon)
+		for _, sample := range samples {
+			key := sample.Category + strconv.Itoa(sample.Number)
+			if _, ok := totals[key]; !ok {
+				continue
+			}
+			totals[key] += sample.RawData
+			counts[key]++
+		}
+	}
+
+	for i, sensor := range sensors {
+		key := sensor.Category + strconv.Itoa(sensor.Number)
+		average := int(math.Round(float64(totals[key]) /
+			float64(counts[key])))
+		sensors[i].IntData = average
+		sensors[i].RawData = average
+	}
+
+	debug("Averaged " + strconv.Itoa(sampleCount) + " samples of each " +
+		"sensor of " + hwmon)
+
+	return sensors, nil
+}
+
+//! Reads every category of sensors of a single device.
+/*
+ * @param      Context     context of the scan, e.g. with its deadline
+ * @param      string      name of the device
+ * @param      string      hwmon directory of the device, e.g. hwmon0
+ *
+ * @returns    Sensor[]    unscaled sensors of the device, which may be none
+ *             error       why the device has no sensors, if it has none
+ */
+func readDeviceSensors(ctx context.Context, name string,
+	hwmon string) ([]tempchk.Sensor, error) {
+
+	sensors := make([]tempchk.Sensor, 0)
+
+	// Thermal zones only ever have the one temperature.
+	if strings.HasPrefix(hwmon, tempchk.ThermalZonePrefix) {
+		found, err := tempchk.ReadThermalZoneContext(ctx,
+			tempchk.ThermalZoneDirectory, name, hwmon)
+		if err != nil {
+			debug("Warning: " + err.Error())
+		}
+		return found, err
+	}
+
+	// Read the whole device at once, then keep the requested categories.
+	found, err := tempchk.ScanDeviceContext(ctx, name, hwmon)
+	if err != nil {
+		debug("Warning: " + err.Error() + " for " + hwmon)
+		return sensors, err
+	}
+
+	// Devices may have any mix of categories; e.g. fans without any
+	// temperatures.
+	for _, category := range sensorCategories {
+		for _, sensor := range found {
+			if sensor.Category == category {
+				sensors = append(sensors, sensor)
+			}
+		}
+	}
+
+	if len(sensors) == 0 {
+		return sensors, errOtherCategories
+	}
+
+	return sensors, nil
+}
+
+//! Assembles the per-driver temperature corrections, as per the flags.
+/*
+ * @returns    tempchk.Corrections    configuration of the corrections
+ */
+func sensorCorrections() tempchk.Corrections {
+	return tempchk.Corrections{
+		K10tempOffset:              k10tempOffset,
+		DigitalAmdPowerModuleInUse: isDigitalAmdPowerModuleInUse(),
+	}
+}
+
+//! Determines whether the AMD digital power module is in use.
+/*
+ * @returns    bool    whether or not the module was detected
+ */
+func isDigitalAmdPowerModuleInUse() bool {
+
+	sensorFlagsMutex.Lock()
+	defer sensorFlagsMutex.Unlock()
+
+	return digitalAmdPowerModuleInUse
+}
+
+//! Records that the AMD digital power module is in use.
+/*
+ * @returns    none
+ */
+func setDigitalAmdPowerModuleInUse() {
+
+	sensorFlagsMutex.Lock()
+	defer sensorFlagsMutex.Unlock()
+
+	digitalAmdPowerModuleInUse = true
+}
+
+// SetGlobalSensorFlags ... alters how Linux sees temperatures
+/*
+ * @param    os.FileInfo[]    array of directory data
+ *
+ * @return   error            error message, if any
+ */
+func SetGlobalSensorFlags(dirs []os.FileInfo) error {
+
+	// input validation
+	if dirs == nil || len(dirs) < 1 {
+		return fmt.Errorf("SetGlobalSensorFlags(): %w",
+			tempchk.ErrInvalidInput)
+	}
+
+	names := make([]string, 0, len(dirs))
+
+	// Cycle thru the entire list of device directories...
+	for _, dir := range dirs {
+
+		// Skip any hwmon entries whose symlinks cannot be resolved within
+		// the configured depth, since they are likely malformed or looped.
+		if !hwmonEntryResolves(dir.Name()) {
+			continue
+		}
+
+		// Skip any devices without a valid hardware name file.
+		nameValueOfHardwareDeviceAsString, ok := deviceNames.lookup(dir)
+		if !ok {
+			continue
+		}
+
+		names = append(names, nameValueOfHardwareDeviceAsString)
+	}
+
+	// Conduct a quick check to determine if the 'fam15h_power' module
+	// is currently in use.
+	if tempchk.DigitalAmdPowerModuleInUse(names) {
+		setDigitalAmdPowerModuleInUse()
 	}
 
 	// everything worked fine, so return null
 	return nil
 }
+
+//! Determines whether two sets of printed sensor values are identical.
+/*
+ * @param      map[string]int    previous values
+ * @param      map[string]int    current values
+ *
+ * @returns    bool              whether or not the values are the same
+ */
+func sameValues(previous map[string]int, current map[string]int) bool {
+
+	if len(previous) != len(current) {
+		return false
+	}
+
+	for key, value := range current {
+		old, ok := previous[key]
+		if !ok || old != value {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,841 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rbisewski/tempchk/pkg/tempchk"
+)
+
+// Reads the hwmon directory from the given in-memory tree for the rest of
+// the test, restoring the real one afterwards.
+func useMemoryFileSystem(t *testing.T, files tempchk.MemoryFileSystem) {
+
+	fileSystem := tempchk.DefaultFileSystem
+	directory := tempchk.HardwareMonitorDirectory
+	tempchk.DefaultFileSystem = files
+	tempchk.HardwareMonitorDirectory = "/sys/class/hwmon/"
+
+	// Names cached by earlier tests would belong to another tree.
+	deviceNames.reset()
+
+	t.Cleanup(func() {
+		tempchk.DefaultFileSystem = fileSystem
+		tempchk.HardwareMonitorDirectory = directory
+		deviceNames.reset()
+	})
+}
+
+// Checks that symlink chains are followed only up to the depth limit.
+func TestResolveSymlink(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/devices/hwmon0/name": "k10temp\n",
+		"/sys/class/hwmon/hwmon0":  tempchk.MemorySymlinkPrefix + "../../devices/hwmon0",
+		"/sys/class/hwmon/hwmon1":  tempchk.MemorySymlinkPrefix + "/sys/class/hwmon/hwmon0",
+		"/sys/class/hwmon/loop":    tempchk.MemorySymlinkPrefix + "loop",
+		"/sys/class/hwmon/broken":  tempchk.MemorySymlinkPrefix + "missing",
+	})
+
+	tests := []struct {
+		path     string
+		depth    int
+		resolved string
+		ok       bool
+	}{
+		{"/sys/devices/hwmon0", 0, "/sys/devices/hwmon0", true},
+		{"/sys/class/hwmon/hwmon0", 1, "/sys/devices/hwmon0", true},
+		{"/sys/class/hwmon/hwmon0", 0, "", false},
+		{"/sys/class/hwmon/hwmon1", 2, "/sys/devices/hwmon0", true},
+		{"/sys/class/hwmon/hwmon1", 1, "", false},
+		{"/sys/class/hwmon/loop", 8, "", false},
+		{"/sys/class/hwmon/broken", 8, "", false},
+	}
+
+	for _, test := range tests {
+
+		resolved, err := resolveSymlink(test.path, test.depth)
+
+		if (err == nil) != test.ok || resolved != test.resolved {
+			t.Errorf("resolveSymlink(%q, %d) = %q, %v, want %q", test.path,
+				test.depth, resolved, err, test.resolved)
+		}
+	}
+}
+
+// Checks that entries are only read if they resolve, and that the stable
+// name comes from the device symlink.
+func TestHwmonEntriesViaFileSystem(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":   "k10temp\n",
+		"/sys/class/hwmon/hwmon0/device": tempchk.MemorySymlinkPrefix + "../../../0000:00:18.3",
+		"/sys/class/hwmon/hwmon1/name":   "nvme\n",
+		"/sys/class/hwmon/hwmon2":        tempchk.MemorySymlinkPrefix + "hwmon2",
+	})
+
+	tests := []struct {
+		hwmon    string
+		resolves bool
+		stable   string
+	}{
+		{"hwmon0", true, "0000:00:18.3"},
+		{"hwmon1", true, ""},
+		{"hwmon2", false, ""},
+	}
+
+	for _, test := range tests {
+
+		if resolves := hwmonEntryResolves(test.hwmon); resolves != test.resolves {
+			t.Errorf("hwmonEntryResolves(%q) = %v, want %v", test.hwmon,
+				resolves, test.resolves)
+		}
+
+		if stable := stableDeviceName(test.hwmon); stable != test.stable {
+			t.Errorf("stableDeviceName(%q) = %q, want %q", test.hwmon, stable,
+				test.stable)
+		}
+	}
+}
+
+// Checks that a whole scan can be run against an in-memory tree.
+func TestScanDevicesMemoryFileSystem(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "nvme\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "38000\n",
+		"/sys/class/hwmon/hwmon0/fan1_input":  "1200\n",
+		"/sys/class/hwmon/hwmon1/name":        "acpitz\n",
+		"/sys/class/hwmon/hwmon2":             tempchk.MemorySymlinkPrefix + "hwmon2",
+	})
+
+	devices, err := ScanDevices()
+	if err != nil {
+		t.Fatalf("ScanDevices() error = %v", err)
+	}
+
+	if len(devices) != 2 || devices[0].name != "nvme" ||
+		devices[1].name != "acpitz" {
+		t.Fatalf("ScanDevices() = %+v, want nvme and acpitz", devices)
+	}
+
+	sensors := devices[0].sensors
+	if len(sensors) != 2 || sensors[0].IntData != 38 ||
+		sensors[1].IntData != 1200 {
+		t.Errorf("sensors of nvme = %+v, want 38 C and 1200 RPM", sensors)
+	}
+
+	if len(devices[1].sensors) != 0 || devices[1].err == nil {
+		t.Errorf("acpitz = %+v, want no sensors and a reason", devices[1])
+	}
+}
+
+// Checks that concurrent scans, e.g. those of -listen, share the sensor
+// flags and the name cache safely; run under go test -race.
+func TestScanDevicesConcurrently(t *testing.T) {
+
+	files := tempchk.MemoryFileSystem{
+		"/proc/cpuinfo": "model name\t: AMD Ryzen 7 5800X\n",
+	}
+	for i, name := range []string{"k10temp", "fam15h_power", "nvme", "it8792"} {
+		dir := "/sys/class/hwmon/hwmon" + strconv.Itoa(i) + "/"
+		files[dir+"name"] = name + "\n"
+		files[dir+"temp1_input"] = strconv.Itoa(40000+i*1000) + "\n"
+		files[dir+"fan1_input"] = "1200\n"
+	}
+	useMemoryFileSystem(t, files)
+
+	// The flag sticks once set, so unset it for the other tests.
+	t.Cleanup(func() {
+		sensorFlagsMutex.Lock()
+		digitalAmdPowerModuleInUse = false
+		sensorFlagsMutex.Unlock()
+	})
+
+	var scans sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		scans.Add(1)
+		go func() {
+			defer scans.Done()
+
+			devices, err := ScanDevices()
+			if err != nil || len(devices) != 4 {
+				t.Errorf("ScanDevices() = %d devices, %v, want 4",
+					len(devices), err)
+			}
+		}()
+	}
+	scans.Wait()
+
+	if !isDigitalAmdPowerModuleInUse() {
+		t.Errorf("isDigitalAmdPowerModuleInUse() = false, want true")
+	}
+}
+
+// MemoryFileSystem whose read of the gated file waits until each of the
+// awaited files has been read, so that it finishes last.
+type gatedFileSystem struct {
+	tempchk.MemoryFileSystem
+	gated string
+
+	mutex    sync.Mutex
+	awaited  map[string]bool
+	opened   chan struct{}
+	timedOut bool
+}
+
+func (g *gatedFileSystem) ReadFile(path string) ([]byte, error) {
+
+	if path == g.gated {
+		select {
+		case <-g.opened:
+		case <-time.After(time.Second):
+			g.mutex.Lock()
+			g.timedOut = true
+			g.mutex.Unlock()
+		}
+	}
+
+	g.mutex.Lock()
+	if g.awaited[path] {
+		delete(g.awaited, path)
+		if len(g.awaited) == 0 {
+			close(g.opened)
+		}
+	}
+	g.mutex.Unlock()
+
+	return g.MemoryFileSystem.ReadFile(path)
+}
+
+// Checks that the devices are read at once, and that the output stays in
+// directory order even when the first device is the last one read.
+func TestScanDevicesReadsDevicesConcurrently(t *testing.T) {
+
+	fsys := &gatedFileSystem{
+		MemoryFileSystem: tempchk.MemoryFileSystem{},
+		gated:            "/sys/class/hwmon/hwmon0/temp1_input",
+		awaited:          make(map[string]bool),
+		opened:           make(chan struct{}),
+	}
+	for i, name := range []string{"coretemp", "nvme", "acpitz", "it8792"} {
+		dir := "/sys/class/hwmon/hwmon" + strconv.Itoa(i) + "/"
+		fsys.MemoryFileSystem[dir+"name"] = name + "\n"
+		fsys.MemoryFileSystem[dir+"temp1_input"] =
+			strconv.Itoa(40000+i*1000) + "\n"
+		if i > 0 {
+			fsys.awaited[dir+"temp1_input"] = true
+		}
+	}
+
+	useMemoryFileSystem(t, fsys.MemoryFileSystem)
+	tempchk.DefaultFileSystem = fsys
+
+	devices, err := ScanDevices()
+	if err != nil {
+		t.Fatalf("ScanDevices() error = %v", err)
+	}
+
+	if fsys.timedOut {
+		t.Errorf("hwmon0 was read before the other devices, rather than " +
+			"alongside them")
+	}
+
+	names := make([]string, 0)
+	for _, device := range devices {
+		names = append(names, device.hwmon+" "+device.name+" "+
+			strconv.Itoa(device.sensors[0].IntData))
+	}
+
+	want := []string{"hwmon0 coretemp 40", "hwmon1 nvme 41",
+		"hwmon2 acpitz 42", "hwmon3 it8792 43"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("ScanDevices() = %q, want %q", names, want)
+	}
+}
+
+// MemoryFileSystem whose reads of the files with the given prefix each
+// take the given delay and then fail, counting how many have been started.
+type slowFileSystem struct {
+	tempchk.MemoryFileSystem
+	prefix string
+	delay  time.Duration
+
+	mutex sync.Mutex
+	reads int
+}
+
+func (s *slowFileSystem) ReadFile(path string) ([]byte, error) {
+
+	if !strings.HasPrefix(path, s.prefix) {
+		return s.MemoryFileSystem.ReadFile(path)
+	}
+
+	s.mutex.Lock()
+	s.reads++
+	s.mutex.Unlock()
+
+	time.Sleep(s.delay)
+
+	return nil, &os.PathError{Op: "read", Path: path, Err: syscall.EIO}
+}
+
+func (s *slowFileSystem) readCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.reads
+}
+
+// Checks that a scan past its -deadline returns what it has, and that the
+// device still being read gives up on the rest of its sensors, rather than
+// trying each of them in turn.
+func TestScanDevicesDeadline(t *testing.T) {
+
+	fsys := &slowFileSystem{
+		MemoryFileSystem: tempchk.MemoryFileSystem{
+			"/sys/class/hwmon/hwmon0/name":        "coretemp\n",
+			"/sys/class/hwmon/hwmon0/temp1_input": "45000\n",
+			"/sys/class/hwmon/hwmon1/name":        "buggy\n",
+		},
+		prefix: "/sys/class/hwmon/hwmon1/temp",
+		delay:  40 * time.Millisecond,
+	}
+	for i := 1; i <= 5; i++ {
+		fsys.MemoryFileSystem["/sys/class/hwmon/hwmon1/temp"+
+			strconv.Itoa(i)+"_input"] = "40000\n"
+	}
+
+	useMemoryFileSystem(t, fsys.MemoryFileSystem)
+	tempchk.DefaultFileSystem = fsys
+
+	deadline := scanDeadline
+	scanDeadline = 60 * time.Millisecond
+	t.Cleanup(func() { scanDeadline = deadline })
+
+	devices, err := ScanDevices()
+	if err != errScanDeadline || len(devices) != 1 ||
+		devices[0].name != "coretemp" {
+		t.Fatalf("ScanDevices() = %+v, %v, want just coretemp and "+
+			"errScanDeadline", devices, err)
+	}
+
+	// Give the slow device the chance to read on, were it to do so.
+	time.Sleep(250 * time.Millisecond)
+
+	if reads := fsys.readCount(); reads > 2 {
+		t.Errorf("%d reads of the slow device were started, want those "+
+			"before the deadline only", reads)
+	}
+}
+
+// Checks that corrected temperatures are compared against limits that are
+// corrected alike, e.g. a k10temp reading of 45 C against its max of 70 C.
+func TestScanDevicesCorrectsLimits(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "k10temp\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "45125\n",
+		"/sys/class/hwmon/hwmon0/temp1_max":   "70000\n",
+	})
+
+	devices, err := ScanDevices()
+	if err != nil || len(devices) != 1 || len(devices[0].sensors) != 1 {
+		t.Fatalf("ScanDevices() = %+v, %v, want one k10temp sensor",
+			devices, err)
+	}
+
+	sensor := devices[0].sensors[0]
+	if sensor.IntData != 45+k10tempOffset ||
+		sensor.Limits[tempchk.MaxSuffix] != 70+k10tempOffset {
+		t.Errorf("temp1 = %d C, max %d C, want both corrected by %d",
+			sensor.IntData, sensor.Limits[tempchk.MaxSuffix], k10tempOffset)
+	}
+
+	if tempchk.OverTemperature(sensor) {
+		t.Errorf("OverTemperature(temp1) = true, want false")
+	}
+
+	if headroom, ok := headroomPercent(sensor); !ok || headroom != 75 {
+		t.Errorf("headroomPercent(temp1) = %d, %v, want 75", headroom, ok)
+	}
+}
+
+// Checks that a missing hwmon directory is reported as ErrHwmonNotFound,
+// caused by the IO error of the failed read.
+func TestScanDevicesHwmonNotFound(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{})
+
+	_, err := ScanDevices()
+	if !errors.Is(err, tempchk.ErrHwmonNotFound) ||
+		!errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ScanDevices() error = %v, want ErrHwmonNotFound and "+
+			"fs.ErrNotExist", err)
+	}
+}
+
+// Checks that the thermal zones are read when there is no hwmon directory
+// at all, as in some containers, rather than giving up on the scan.
+func TestScanDevicesThermalZonesWithoutHwmon(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/thermal/thermal_zone0/type": "acpitz\n",
+		"/sys/class/thermal/thermal_zone0/temp": "27800\n",
+	})
+
+	if !sensorsAvailable() {
+		t.Errorf("sensorsAvailable() = false, want true")
+	}
+
+	devices, err := ScanDevices()
+	if err != nil || len(devices) != 1 || len(devices[0].sensors) != 1 {
+		t.Fatalf("ScanDevices() = %+v, %v, want one thermal zone", devices,
+			err)
+	}
+
+	if devices[0].name != "acpitz" || devices[0].sensors[0].IntData != 27 {
+		t.Errorf("ScanDevices() = %s at %d C, want acpitz at 27 C",
+			devices[0].name, devices[0].sensors[0].IntData)
+	}
+
+	// Without either, there is nothing to read.
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{})
+	if sensorsAvailable() {
+		t.Errorf("sensorsAvailable() of an empty tree = true, want false")
+	}
+}
+
+// Checks that -number selects a single sensor of the -number-category,
+// and that -value-only prints it as the table would, e.g. 1.104 V.
+func TestNumberFilterValueOnly(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "nct6798\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "40000\n",
+		"/sys/class/hwmon/hwmon0/fan1_input":  "1200\n",
+		"/sys/class/hwmon/hwmon0/in0_input":   "1104\n",
+		"/sys/class/hwmon/hwmon0/in1_input":   "12096\n",
+	})
+
+	number, category := numberFilter, numberCategory
+	categories, only := sensorCategories, valueOnly
+	sensorCategories = append([]string{tempchk.TempPrefix, tempchk.FanPrefix},
+		extraSensorCategories...)
+	valueOnly = true
+	t.Cleanup(func() {
+		numberFilter, numberCategory = number, category
+		sensorCategories, valueOnly = categories, only
+	})
+
+	tests := []struct {
+		number   int
+		category string
+		value    string
+	}{
+		{1, tempchk.TempPrefix, "40\n"},
+		{1, tempchk.FanPrefix, "1200\n"},
+		{0, tempchk.VoltagePrefix, "1.104\n"},
+		{1, tempchk.VoltagePrefix, "12.096\n"},
+	}
+
+	for _, test := range tests {
+
+		numberFilter, numberCategory = test.number, test.category
+
+		devices, err := ScanDevices()
+		if err != nil {
+			t.Fatalf("ScanDevices() error = %v", err)
+		}
+
+		var output bytes.Buffer
+		_, err = printSensors(&output, devices)
+
+		if err != nil || output.String() != test.value {
+			t.Errorf("-number %d -number-category %s printed %q, %v, want %q",
+				test.number, test.category, output.String(), err, test.value)
+		}
+	}
+
+	// Without -number, several sensors match, so there is no one value.
+	numberFilter = -1
+
+	devices, err := ScanDevices()
+	if err != nil {
+		t.Fatalf("ScanDevices() error = %v", err)
+	}
+
+	var output bytes.Buffer
+	if _, err := printSensors(&output, devices); err == nil {
+		t.Errorf("-value-only of several sensors printed %q, want an error",
+			output.String())
+	}
+}
+
+// Checks that -round keeps the fraction of temperatures in every -unit,
+// while fans stay whole.
+func TestSensorValueRoundAndUnit(t *testing.T) {
+
+	decimals, unit := roundDecimals, temperatureUnit
+	t.Cleanup(func() { roundDecimals, temperatureUnit = decimals, unit })
+
+	temp := tempchk.ScaleSensor(tempchk.Sensor{
+		Name:     "nvme",
+		Category: tempchk.TempPrefix,
+		IntData:  30000,
+		RawData:  30000,
+	}, 1000)
+	fan := tempchk.ScaleSensor(tempchk.Sensor{
+		Name:     "it8792",
+		Category: tempchk.FanPrefix,
+		IntData:  1234,
+		RawData:  1234,
+	}, 1)
+
+	tests := []struct {
+		sensor   tempchk.Sensor
+		decimals int
+		unit     string
+		text     string
+	}{
+		{temp, 0, "C", "30"},
+		{temp, 1, "C", "30.0"},
+		{temp, 0, "K", "303"},
+		{temp, 2, "F", "86.00"},
+		{temp, 2, "K", "303.15"},
+		{temp, 3, "K", "303.150"},
+		{fan, 2, "C", "1234"},
+		{fan, 2, "K", "1234"},
+	}
+
+	for _, test := range tests {
+
+		roundDecimals, temperatureUnit = test.decimals, test.unit
+
+		// The integer path is converted up front, as by ScanDevices.
+		sensor := test.sensor
+		if sensor.Category == tempchk.TempPrefix {
+			sensor.IntData = convertTemperature(sensor.IntData)
+		}
+
+		if _, text := sensorValue(sensor); text != test.text {
+			t.Errorf("sensorValue(%s) with -round %d -unit %s = %q, want %q",
+				sensor.Category, test.decimals, test.unit, text, test.text)
+		}
+	}
+}
+
+// Checks that temperatures convert to each -unit and back again, using the
+// exact offset of kelvins.
+func TestConvertTemperature(t *testing.T) {
+
+	unit := temperatureUnit
+	t.Cleanup(func() { temperatureUnit = unit })
+
+	tests := []struct {
+		unit      string
+		celsius   int
+		converted int
+	}{
+		{"C", 45, 45},
+		{"F", 45, 113},
+		{"F", -40, -40},
+		{"K", 45, 318},
+		{"K", 0, 273},
+		{"K", -273, 0},
+	}
+
+	for _, test := range tests {
+
+		temperatureUnit = test.unit
+
+		if converted := convertTemperature(test.celsius); converted !=
+			test.converted {
+			t.Errorf("-unit %s: convertTemperature(%d) = %d, want %d",
+				test.unit, test.celsius, converted, test.converted)
+		}
+		if celsius := celsiusTemperature(test.converted); celsius !=
+			test.celsius {
+			t.Errorf("-unit %s: celsiusTemperature(%d) = %d, want %d",
+				test.unit, test.converted, celsius, test.celsius)
+		}
+	}
+}
+
+// Checks that device names are read from the name file, or its nested
+// fallback, and that devices with neither, or a blank one, are skipped.
+func TestReadDeviceName(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "k10temp\n",
+		"/sys/class/hwmon/hwmon1/device/name": "nvme\n",
+		"/sys/class/hwmon/hwmon2/temp1_input": "45000\n",
+		"/sys/class/hwmon/hwmon3/name":        "\n",
+	})
+
+	dirs, err := tempchk.DefaultFileSystem.ReadDir("/sys/class/hwmon/")
+	if err != nil || len(dirs) != 4 {
+		t.Fatalf("ReadDir() = %d entries, %v, want 4", len(dirs), err)
+	}
+
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"k10temp", true},
+		{"nvme", true},
+		{"", false},
+		{"", false},
+	}
+
+	for i, test := range tests {
+		if name, ok := readDeviceName(dirs[i]); name != test.name ||
+			ok != test.ok {
+			t.Errorf("readDeviceName(%s) = %q, %v, want %q, %v",
+				dirs[i].Name(), name, ok, test.name, test.ok)
+		}
+	}
+}
+
+// Checks that the CLI trims tab, CR and CRLF line endings from device
+// names, readings and labels.
+func TestScanDevicesTrimmedAttributes(t *testing.T) {
+
+	for _, ending := range []string{"\t", "\r", "\r\n"} {
+
+		useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+			"/sys/class/hwmon/hwmon0/name":        "nvme" + ending,
+			"/sys/class/hwmon/hwmon0/temp1_input": "38000" + ending,
+			"/sys/class/hwmon/hwmon0/temp1_label": "Composite" + ending,
+		})
+
+		devices, err := ScanDevices()
+		if err != nil || len(devices) != 1 || len(devices[0].sensors) != 1 {
+			t.Errorf("%q: ScanDevices() = %+v, %v, want one sensor", ending,
+				devices, err)
+			continue
+		}
+
+		sensor := devices[0].sensors[0]
+		if devices[0].name != "nvme" || sensor.Label != "Composite" ||
+			sensor.IntData != 38 {
+			t.Errorf("%q: temp1 = %q %q %d, want \"nvme\" \"Composite\" 38",
+				ending, devices[0].name, sensor.Label, sensor.IntData)
+		}
+	}
+}
+
+// Checks the unit of every category in every -unit-style, along with the
+// temperature units other than Celsius.
+func TestCategoryUnit(t *testing.T) {
+
+	style, unit := unitStyle, temperatureUnit
+	t.Cleanup(func() { unitStyle, temperatureUnit = style, unit })
+
+	categories := []string{"temp", "in", "fan", "curr", "power", "energy",
+		"humidity", "pwm"}
+
+	tests := []struct {
+		style string
+		unit  string
+		units []string
+	}{
+		{"standard", "C", []string{"C", "V", "RPM", "A", "W", "J", "%RH", ""}},
+		{"compact", "C", []string{"C", "V", "r", "A", "W", "J", "%", ""}},
+		{"long", "C", []string{"Celsius", "volts", "revolutions per minute",
+			"amperes", "watts", "joules", "percent relative humidity", ""}},
+		{"standard", "F", []string{"F", "V", "RPM", "A", "W", "J", "%RH", ""}},
+		{"compact", "K", []string{"K", "V", "r", "A", "W", "J", "%", ""}},
+		{"long", "F", []string{"Fahrenheit", "volts",
+			"revolutions per minute", "amperes", "watts", "joules",
+			"percent relative humidity", ""}},
+		{"long", "K", []string{"Kelvin", "volts", "revolutions per minute",
+			"amperes", "watts", "joules", "percent relative humidity", ""}},
+	}
+
+	for _, test := range tests {
+
+		unitStyle, temperatureUnit = test.style, test.unit
+
+		for i, category := range categories {
+			if unit := categoryUnit(category); unit != test.units[i] {
+				t.Errorf("-unit-style %s -unit %s: categoryUnit(%q) = %q, "+
+					"want %q", test.style, test.unit, category, unit,
+					test.units[i])
+			}
+		}
+	}
+}
+
+// Checks that -normalize-names lowercases and trims mixed-case names, as
+// some kernels give, for both display and the -device and -filter matches.
+func TestNormalizeNames(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "K10Temp \n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "45000\n",
+		"/sys/class/hwmon/hwmon1/name":        "NCT6798\t\n",
+		"/sys/class/hwmon/hwmon1/temp1_input": "35000\n",
+	})
+
+	normalize, device, filter := normalizeNames, deviceFilter, deviceNameFilter
+	t.Cleanup(func() {
+		normalizeNames, deviceFilter, deviceNameFilter = normalize, device,
+			filter
+	})
+
+	tests := []struct {
+		normalize bool
+		device    string
+		filter    string
+		names     []string
+	}{
+		{false, "", "", []string{"K10Temp", "NCT6798"}},
+		{true, "", "", []string{"k10temp", "nct6798"}},
+		{false, "nct6798", "", []string{}},
+		{true, "nct6798", "", []string{"nct6798"}},
+		{true, "NCT6798 ", "", []string{"nct6798"}},
+		{false, "", "k10*", []string{"K10Temp"}},
+		{true, "", "K10*", []string{"k10temp"}},
+	}
+
+	for _, test := range tests {
+
+		normalizeNames = test.normalize
+		deviceFilter, deviceNameFilter = test.device, test.filter
+
+		// Names are cached as they were normalized when first read.
+		deviceNames.reset()
+
+		devices, err := ScanDevices()
+		if err != nil {
+			t.Fatalf("ScanDevices() error = %v", err)
+		}
+
+		names := make([]string, 0)
+		for _, device := range devices {
+			names = append(names, device.name)
+		}
+
+		if strings.Join(names, ",") != strings.Join(test.names, ",") {
+			t.Errorf("-normalize-names=%v -device %q -filter %q found %q, "+
+				"want %q", test.normalize, test.device, test.filter, names,
+				test.names)
+		}
+	}
+}
+
+// Checks that the -scale-override divisors replace the default of their
+// chip and category only, and that malformed files are rejected.
+func TestScaleOverrides(t *testing.T) {
+
+	overrides := scaleOverrides
+	t.Cleanup(func() { scaleOverrides = overrides })
+
+	var err error
+	scaleOverrides, err = loadScaleOverrides(writeConfigFile(t,
+		"# volts, rather than millivolts\n\nnct6798:in = 1\n"+
+			"  it8792:temp=100  \n"))
+	if err != nil {
+		t.Fatalf("loadScaleOverrides() error = %v", err)
+	}
+
+	tests := []struct {
+		chip     string
+		category string
+		divisor  int
+	}{
+		{"nct6798", "in", 1},
+		{"it8792", "temp", 100},
+		{"nct6798", "temp", 1000},
+		{"it8792", "in", 1000},
+		{"k10temp", "temp", 1000},
+		{"nct6798", "power", 1000000},
+	}
+
+	for _, test := range tests {
+		divisor := sensorDivisor(test.chip, test.category)
+		if divisor != test.divisor {
+			t.Errorf("sensorDivisor(%q, %q) = %d, want %d", test.chip,
+				test.category, divisor, test.divisor)
+		}
+	}
+
+	for _, contents := range []string{
+		"nct6798 in=1\n",
+		"nct6798:in\n",
+		"nct6798:volts=1\n",
+		"nct6798:in=0\n",
+		"nct6798:in=milli\n",
+	} {
+		_, err := loadScaleOverrides(writeConfigFile(t, contents))
+		if err == nil {
+			t.Errorf("loadScaleOverrides(%q) error = nil, want one", contents)
+		}
+	}
+}
+
+// Checks that -label selects sensors by their label prefix on an nct6798,
+// whose labels do not follow the sensor numbering.
+func TestLabelPrefixFilter(t *testing.T) {
+
+	files := tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name": "nct6798\n",
+	}
+	for number, label := range map[int]string{1: "SYSTIN", 2: "CPUTIN",
+		3: "AUXTIN0", 4: "AUXTIN1", 5: "AUXTIN2", 6: "AUXTIN3",
+		7: "SMBUSMASTER 0", 10: "PECI Agent 0 Calibration", 13: ""} {
+		temp := "/sys/class/hwmon/hwmon0/temp" + strconv.Itoa(number)
+		files[temp+"_input"] = strconv.Itoa(30000+number*1000) + "\n"
+		if label != "" {
+			files[temp+"_label"] = label + "\n"
+		}
+	}
+	useMemoryFileSystem(t, files)
+
+	filter := labelFilter
+	t.Cleanup(func() { labelFilter = filter })
+
+	tests := []struct {
+		filter  string
+		numbers []int
+	}{
+		{"", []int{1, 2, 3, 4, 5, 6, 7, 10, 13}},
+		{"AUXTIN", []int{3, 4, 5, 6}},
+		{"AUXTIN*", []int{3, 4, 5, 6}},
+		{"AUXTIN2", []int{5}},
+		{"CPUTIN", []int{2}},
+		{"PECI", []int{10}},
+		{"auxtin", []int{}},
+	}
+
+	for _, test := range tests {
+
+		labelFilter = test.filter
+
+		devices, err := ScanDevices()
+		if err != nil {
+			t.Fatalf("ScanDevices() error = %v", err)
+		}
+
+		numbers := make([]int, 0)
+		for _, device := range devices {
+			for _, sensor := range device.sensors {
+				numbers = append(numbers, sensor.Number)
+			}
+		}
+
+		if !reflect.DeepEqual(numbers, test.numbers) {
+			t.Errorf("-label %q found temp%v, want temp%v", test.filter,
+				numbers, test.numbers)
+		}
+	}
+}
@@ -1,3 +1,8 @@
 module github.com/rbisewski/tempchk
 
 go 1.16
+
+require (
+	github.com/BurntSushi/toml v1.2.1
+	github.com/gdamore/tcell/v2 v2.4.0
+)
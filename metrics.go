@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rbisewski/tempchk/pkg/tempchk"
+)
+
+// A Prometheus gauge, reporting the sensors of a single category.
+type metric struct {
+
+	// sensor type reported by the gauge; e.g. temp
+	category string
+
+	// name of the gauge; e.g. hwmon_temperature_celsius
+	name string
+
+	// description of the gauge, as per its HELP line
+	help string
+}
+
+// gauges exported by -listen, in the order they are written
+var metrics = []metric{
+	{"temp", "hwmon_temperature_celsius",
+		"Temperature of a hwmon sensor, in degrees Celsius."},
+	{"fan", "hwmon_fan_rpm",
+		"Speed of a hwmon fan, in revolutions per minute."},
+	{"in", "hwmon_voltage_volts",
+		"Voltage of a hwmon sensor, in volts."},
+	{"curr", "hwmon_current_amperes",
+		"Current of a hwmon sensor, in amperes."},
+	{"power", "hwmon_power_watts",
+		"Power of a hwmon sensor, in watts."},
+}
+
+// escapes label values as per the Prometheus text format
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`,
+	"\n", `\n`)
+
+// Background samples of the gauges, averaged over a rolling window.
+type metricAverages struct {
+
+	// guards the samples, since scrapes read them while the sampler writes
+	mutex sync.Mutex
+
+	// how far back the samples are averaged over
+	window time.Duration
+
+	// samples taken within the window, oldest first
+	samples []metricSample
+}
+
+// Values of every gauge at a single point in time.
+type metricSample struct {
+
+	// when the sample was taken
+	at time.Time
+
+	// values of the gauges, keyed by gauge name and labels; e.g.
+	// hwmon_temperature_celsius{device="hwmon0",name="k10temp",sensor="1"}
+	values map[string]float64
+}
+
+//! Assembles the labels of the gauge of a sensor.
+/*
+ * @param      Device    device of the sensor
+ * @param      Sensor    sensor to label
+ *
+ * @returns    string    labels, e.g. {device="hwmon0",name="k10temp",sensor="1"}
+ */
+func metricLabels(device Device, sensor tempchk.Sensor) string {
+	return "{device=\"" + metricLabelEscaper.Replace(deviceID(device)) +
+		"\",name=\"" + metricLabelEscaper.Replace(device.name) +
+		"\",sensor=\"" + strconv.Itoa(sensor.Number) + "\"}"
+}
+
+//! Writes the sensors of the given devices in the Prometheus text format.
+/*
+ * @param      strings.Builder    destination of the metrics
+ * @param      Device[]           devices to write the sensors of
+ * @param      metricAverages     rolling averages to also write, as *_avg
+ *                                gauges; nil if there are none
+ *
+ * @returns    none
+ */
+func writeMetrics(b *strings.Builder, devices []Device,
+	averages *metricAverages) {
+
+	for _, m := range metrics {
+
+		lines := make([]string, 0)
+		averageLines := make([]string, 0)
+		for _, device := range devices {
+			for _, sensor := range device.sensors {
+
+				if sensor.Category != m.category {
+					continue
+				}
+
+				labels := metricLabels(device, sensor)
+
+				lines = append(lines, m.name+labels+" "+
+					strconv.FormatFloat(sensor.Value(), 'f', -1, 64))
+
+				if averages == nil {
+					continue
+				}
+
+				// Sensors that only just appeared have no samples yet.
+				if average, ok := averages.average(m.name + labels); ok {
+					averageLines = append(averageLines, m.name+"_avg"+
+						labels+" "+strconv.FormatFloat(average, 'f', -1, 64))
+				}
+			}
+		}
+
+		// Gauges without any sensors are left out entirely.
+		if len(lines) == 0 {
+			continue
+		}
+
+		b.WriteString("# HELP " + m.name + " " + m.help + "\n")
+		b.WriteString("# TYPE " + m.name + " gauge\n")
+		for _, line := range lines {
+			b.WriteString(line + "\n")
+		}
+
+		if len(averageLines) == 0 {
+			continue
+		}
+
+		b.WriteString("# HELP " + m.name + "_avg " +
+			strings.TrimSuffix(m.help, ".") + ", averaged over the last " +
+			averages.window.String() + ".\n")
+		b.WriteString("# TYPE " + m.name + "_avg gauge\n")
+		for _, line := range averageLines {
+			b.WriteString(line + "\n")
+		}
+	}
+}
+
+//! Creates an empty set of rolling averages.
+/*
+ * @param      time.Duration     how far back the samples are averaged over
+ *
+ * @returns    metricAverages    averages without any samples
+ */
+func newMetricAverages(window time.Duration) *metricAverages {
+	return &metricAverages{
+		window:  window,
+		samples: make([]metricSample, 0),
+	}
+}
+
+//! Records a sample of every gauge, dropping any older than the window.
+/*
+ * @returns    none
+ */
+func (a *metricAverages) sample() {
+
+	devices, err := ScanDevices()
+	if err != nil && err != errScanDeadline {
+		debug("Warning: unable to sample the sensors: " + err.Error())
+		return
+	}
+
+	values := make(map[string]float64)
+	for _, m := range metrics {
+		for _, device := range devices {
+			for _, sensor := range device.sensors {
+				if sensor.Category == m.category {
+					values[m.name+metricLabels(device, sensor)] =
+						sensor.Value()
+				}
+			}
+		}
+	}
+
+	now := time.Now()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.samples = append(a.samples, metricSample{at: now, values: values})
+
+	// The samples are in order, so the expired ones are all at the front.
+	expired := 0
+	for expired < len(a.samples) &&
+		now.Sub(a.samples[expired].at) > a.window {
+		expired++
+	}
+	a.samples = a.samples[expired:]
+}
+
+//! Averages the samples of a single gauge.
+/*
+ * @param      string     gauge name and labels, as keyed in the samples
+ *
+ * @returns    float64    average of the samples within the window
+ *             bool       whether or not there are any such samples
+ */
+func (a *metricAverages) average(key string) (float64, bool) {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	total := 0.0
+	count := 0
+	for _, sample := range a.samples {
+		if value, ok := sample.values[key]; ok {
+			total += value
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0, false
+	}
+
+	return total / float64(count), true
+}
+
+//! Samples the sensors at the given interval, until told to stop.
+/*
+ * @param      chan             closed to stop the sampler
+ * @param      time.Duration    delay between each of the samples
+ *
+ * @returns    none
+ */
+func (a *metricAverages) run(stop <-chan struct{}, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		a.sample()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//! Creates the handler of the /metrics endpoint.
+/*
+ * The sensors are re-read on every scrape, so that the gauges are current.
+ *
+ * @param      metricAverages      rolling averages to also serve; nil if
+ *                                 there are none
+ *
+ * @returns    http.HandlerFunc    handler of the scrapes
+ */
+func metricsHandler(averages *metricAverages) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		devices, err := ScanDevices()
+
+		// A scan that ran out of time still has readings worth reporting.
+		if err != nil && err != errScanDeadline {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var b strings.Builder
+		writeMetrics(&b, devices, averages)
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, b.String())
+	}
+}
+
+//! Runs the metrics server until it fails or is interrupted.
+/*
+ * @param      string    address to listen on, e.g. :9101
+ *
+ * @returns    error     why the server stopped; nil if it was interrupted
+ */
+func serveMetrics(address string) error {
+
+	mux := http.NewServeMux()
+	server := &http.Server{Addr: address, Handler: mux}
+
+	// closed once the server has stopped, to stop the sampler too
+	stop := make(chan struct{})
+	var sampler sync.WaitGroup
+
+	var averages *metricAverages
+	if averageWindow > 0 {
+		averages = newMetricAverages(averageWindow)
+
+		sampler.Add(1)
+		go func() {
+			defer sampler.Done()
+			averages.run(stop, averageSampleInterval)
+		}()
+	}
+
+	mux.HandleFunc("/metrics", metricsHandler(averages))
+
+	// Stop cleanly on Ctrl-C, rather than mid-scrape or mid-sample.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	// Every scrape scans afresh anyway, so a SIGHUP need only forget the
+	// cached names, and take a fresh sample for the averages.
+	hangups := notifyRescans()
+	defer signal.Stop(hangups)
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				server.Shutdown(context.Background())
+				return
+			case <-hangups:
+				rescanDevices()
+				if averages != nil {
+					averages.sample()
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	debug("Serving metrics at " + address + "/metrics")
+
+	err := server.ListenAndServe()
+
+	close(stop)
+	sampler.Wait()
+
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return fmt.Errorf("serveMetrics(): %w", err)
+}
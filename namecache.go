@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+// Names of the hwmon devices, kept across scans so that repeated scans,
+// e.g. in watch mode, need not re-read every name file each time.
+type deviceNameCache struct {
+
+	// guards the names, since scans may run concurrently; e.g. -listen
+	mutex sync.Mutex
+
+	// trimmed names of the devices, keyed by hwmon directory; e.g. hwmon0
+	names map[string]string
+}
+
+//! Creates an empty cache of device names.
+/*
+ * @returns    deviceNameCache    cache without any names
+ */
+func newDeviceNameCache() *deviceNameCache {
+	return &deviceNameCache{names: make(map[string]string)}
+}
+
+//! Looks up the name of a device, reading its name file if not yet cached.
+/*
+ * Devices without a valid name are not cached, so that they are checked
+ * again on the next scan.
+ *
+ * @param      os.FileInfo    entry of the hwmon directory, e.g. hwmon0
+ *
+ * @returns    string         trimmed name of the device, e.g. k10temp
+ *             bool           whether or not the device has a valid name
+ */
+func (c *deviceNameCache) lookup(dir os.FileInfo) (string, bool) {
+
+	c.mutex.Lock()
+	name, ok := c.names[dir.Name()]
+	c.mutex.Unlock()
+
+	if ok {
+		return name, true
+	}
+
+	name, ok = readDeviceName(dir)
+	if !ok {
+		return "", false
+	}
+
+	c.mutex.Lock()
+	c.names[dir.Name()] = name
+	c.mutex.Unlock()
+
+	return name, true
+}
+
+//! Forgets the names of any devices that are no longer present.
+/*
+ * @param      os.FileInfo[]    current entries of the hwmon directory
+ *
+ * @returns    none
+ */
+func (c *deviceNameCache) prune(dirs []os.FileInfo) {
+
+	present := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		present[dir.Name()] = true
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for hwmon := range c.names {
+		if !present[hwmon] {
+			debug("Forgetting the name of " + hwmon + ", since it is no " +
+				"longer present")
+			delete(c.names, hwmon)
+		}
+	}
+}
+
+//! Forgets the names of every device, so the next scan re-reads them all.
+/*
+ * @returns    none
+ */
+func (c *deviceNameCache) reset() {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.names = make(map[string]string)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rbisewski/tempchk/pkg/tempchk"
+)
+
+// Checks that pruned devices are forgotten, so that a hwmonN reused by
+// another chip, e.g. after a module reload, is given its new name.
+func TestDeviceNameCachePrune(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name": "k10temp\n",
+		"/sys/class/hwmon/hwmon1/name": "nvme\n",
+	})
+
+	cache := newDeviceNameCache()
+
+	dirs, _ := tempchk.DefaultFileSystem.ReadDir("/sys/class/hwmon/")
+	for i, want := range []string{"k10temp", "nvme"} {
+		if name, ok := cache.lookup(dirs[i]); !ok || name != want {
+			t.Fatalf("lookup(%s) = %q, %v, want %q", dirs[i].Name(), name,
+				ok, want)
+		}
+	}
+
+	// hwmon0 goes away, and is forgotten.
+	tempchk.DefaultFileSystem = tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon1/name": "nvme\n",
+	}
+	dirs, _ = tempchk.DefaultFileSystem.ReadDir("/sys/class/hwmon/")
+	cache.prune(dirs)
+
+	if _, ok := cache.names["hwmon0"]; ok {
+		t.Errorf("hwmon0 is still cached after being pruned")
+	}
+	if cache.names["hwmon1"] != "nvme" {
+		t.Errorf("hwmon1 = %q after pruning, want nvme", cache.names["hwmon1"])
+	}
+
+	// hwmon0 comes back as another chip, which is read afresh.
+	tempchk.DefaultFileSystem = tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name": "amdgpu\n",
+		"/sys/class/hwmon/hwmon1/name": "nvme\n",
+	}
+	dirs, _ = tempchk.DefaultFileSystem.ReadDir("/sys/class/hwmon/")
+	cache.prune(dirs)
+
+	if name, ok := cache.lookup(dirs[0]); !ok || name != "amdgpu" {
+		t.Errorf("lookup(hwmon0) = %q, %v, want amdgpu", name, ok)
+	}
+}
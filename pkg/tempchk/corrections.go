@@ -0,0 +1,120 @@
+package tempchk
+
+// Corrections holds what the per-driver temperature corrections depend on,
+// so that the CLI and the Scanner correct the same chips the same way.
+type Corrections struct {
+
+	// degrees added to k10temp readings, when the AMD digital power
+	// module is not in use
+	K10tempOffset int
+
+	// whether or not the AMD digital power module is in use, in which
+	// case k10temp reports the actual temperature
+	DigitalAmdPowerModuleInUse bool
+}
+
+// Corrections of the temperatures of drivers known to misreport them, keyed
+// by driver name; each is given and returns degrees Celsius.
+var temperatureCorrections = map[string]func(Corrections, int) int{
+	"k10temp": correctK10temp,
+}
+
+// name of the driver of the AMD digital power module
+const digitalAmdPowerModuleName = "fam15h_power"
+
+//! Corrects a k10temp temperature, as a work-around for the k10temp module.
+/*
+ * @param      Corrections    configuration of the corrections
+ * @param      int            temperature as read, in degrees Celsius
+ *
+ * @returns    int            corrected temperature, in degrees Celsius
+ */
+func correctK10temp(c Corrections, celsius int) int {
+
+	// The AMD digital power module reports the actual temperature.
+	if c.DigitalAmdPowerModuleInUse {
+		return celsius
+	}
+
+	return celsius + c.K10tempOffset
+}
+
+//! Corrects a temperature of the given driver, if it is known to misreport.
+/*
+ * @param      string    name of the driver, e.g. k10temp
+ * @param      int       temperature as read, in degrees Celsius
+ *
+ * @returns    int       corrected temperature, in degrees Celsius; as read
+ *                       for drivers without a correction
+ */
+func (c Corrections) CorrectTemperature(name string, celsius int) int {
+
+	correct, ok := temperatureCorrections[name]
+	if !ok {
+		return celsius
+	}
+
+	return correct(c, celsius)
+}
+
+//! Corrects the value and limits of a scaled temperature sensor.
+/*
+ * The limits are read the same way as the value, so are corrected alike
+ * to stay comparable, e.g. by OverTemperature.
+ *
+ * @param      Sensor    sensor, with its values scaled to degrees Celsius
+ *
+ * @returns    Sensor    corrected sensor; others than temperatures, and
+ *                       those of drivers without a correction, are as given
+ */
+func (c Corrections) CorrectSensor(sensor Sensor) Sensor {
+
+	if sensor.Category != TempPrefix {
+		return sensor
+	}
+
+	if _, ok := temperatureCorrections[sensor.Name]; !ok {
+		return sensor
+	}
+
+	sensor.IntData = c.CorrectTemperature(sensor.Name, sensor.IntData)
+
+	// Copy the limits, so as to not alter those of the original sensor.
+	limits := make(map[string]int, len(sensor.Limits))
+	for suffix, limit := range sensor.Limits {
+		limits[suffix] = c.CorrectTemperature(sensor.Name, limit)
+	}
+	sensor.Limits = limits
+
+	return sensor
+}
+
+//! Determines whether the AMD digital power module is in use.
+/*
+ * @param      string[]    names of the hwmon devices present
+ *
+ * @returns    bool        whether or not the fam15h_power module is loaded,
+ *                         or the CPU is a Ryzen
+ */
+func DigitalAmdPowerModuleInUse(names []string) bool {
+	return digitalAmdPowerModuleInUse(DefaultFileSystem, names)
+}
+
+//! Determines whether the AMD digital power module is in use, per a filesystem.
+/*
+ * @param      FileSystem    filesystem to read the CPU info file from
+ * @param      string[]      names of the hwmon devices present
+ *
+ * @returns    bool          whether or not the fam15h_power module is
+ *                           loaded, or the CPU is a Ryzen
+ */
+func digitalAmdPowerModuleInUse(fsys FileSystem, names []string) bool {
+
+	for _, name := range names {
+		if name == digitalAmdPowerModuleName {
+			return true
+		}
+	}
+
+	return cpuIsRyzen(fsys)
+}
@@ -0,0 +1,57 @@
+package tempchk
+
+// An error that is one of the sentinel errors, e.g. ErrNoSensors, while
+// also being caused by another error, e.g. ErrNoInputFiles or that of a
+// failed read; errors.Is matches both.
+type causedError struct {
+
+	// sentinel error this is, e.g. ErrNoSensors
+	sentinel error
+
+	// description of what went wrong; e.g. no valid temp sensors
+	message string
+
+	// error that caused it
+	cause error
+}
+
+//! Wraps the cause of an error along with the sentinel error it is.
+/*
+ * Callers that read the hwmon directory themselves can use this to report
+ * failures the same way, e.g. as ErrHwmonNotFound caused by fs.ErrNotExist.
+ *
+ * @param      error     sentinel error, e.g. ErrHwmonNotFound
+ * @param      string    description of what went wrong
+ * @param      error     error that caused it
+ *
+ * @returns    error     error matching both the sentinel and the cause
+ */
+func NewCausedError(sentinel error, message string, cause error) error {
+	return &causedError{sentinel: sentinel, message: message, cause: cause}
+}
+
+//! Describes the error, followed by its cause.
+/*
+ * @returns    string    e.g. no valid temp sensors, no input files found
+ */
+func (e *causedError) Error() string {
+	return e.message + ", " + e.cause.Error()
+}
+
+//! Determines whether the error is the given sentinel, as per errors.Is.
+/*
+ * @param      error    sentinel error to compare against
+ *
+ * @returns    bool     whether or not this is that sentinel error
+ */
+func (e *causedError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+//! Obtains the cause of the error, as per errors.Unwrap.
+/*
+ * @returns    error    error that caused this one
+ */
+func (e *causedError) Unwrap() error {
+	return e.cause
+}
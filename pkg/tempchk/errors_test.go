@@ -0,0 +1,90 @@
+package tempchk
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+// MemoryFileSystem whose reads of the given files fail with the given errors.
+type failingFileSystem struct {
+	MemoryFileSystem
+	errs map[string]error
+}
+
+func (f failingFileSystem) ReadFile(path string) ([]byte, error) {
+
+	if err, ok := f.errs[path]; ok {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+
+	return f.MemoryFileSystem.ReadFile(path)
+}
+
+// Checks that the errors of a device scan match both their sentinels and
+// the IO errors that caused them, as per errors.Is.
+func TestScanDeviceErrors(t *testing.T) {
+
+	device := MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "k10temp\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "45000\n",
+	}
+
+	tests := []struct {
+		name      string
+		fsys      FileSystem
+		directory string
+		hwmon     string
+		matches   []error
+	}{
+		{"invalid input", device, "", "hwmon0",
+			[]error{ErrInvalidInput}},
+		{"no input files", MemoryFileSystem{
+			"/sys/class/hwmon/hwmon0/name": "acpitz\n",
+		}, "/sys/class/hwmon/", "hwmon0",
+			[]error{ErrNoSensors, ErrNoInputFiles}},
+		{"missing device", device, "/sys/class/hwmon/", "hwmon9",
+			[]error{ErrNoSensors, ErrInputUnreadable, fs.ErrNotExist}},
+		{"permission denied", failingFileSystem{device, map[string]error{
+			"/sys/class/hwmon/hwmon0/temp1_input": os.ErrPermission,
+		}}, "/sys/class/hwmon/", "hwmon0",
+			[]error{ErrNoSensors, ErrInputPermission, fs.ErrPermission}},
+		{"unreadable", failingFileSystem{device, map[string]error{
+			"/sys/class/hwmon/hwmon0/temp1_input": os.ErrNotExist,
+		}}, "/sys/class/hwmon/", "hwmon0",
+			[]error{ErrNoSensors, ErrInputUnreadable, fs.ErrNotExist}},
+		{"unparseable", MemoryFileSystem{
+			"/sys/class/hwmon/hwmon0/name":        "k10temp\n",
+			"/sys/class/hwmon/hwmon0/temp1_input": "n/a\n",
+		}, "/sys/class/hwmon/", "hwmon0",
+			[]error{ErrNoSensors, ErrInputUnparseable}},
+	}
+
+	for _, test := range tests {
+
+		_, err := scanDevice(test.fsys, test.directory, "k10temp", test.hwmon)
+
+		for _, target := range test.matches {
+			if !errors.Is(err, target) {
+				t.Errorf("%s: scanDevice() error = %v, want it to match %v",
+					test.name, err, target)
+			}
+		}
+	}
+}
+
+// Checks that a scan of a missing hwmon directory matches both
+// ErrHwmonNotFound and the IO error that caused it.
+func TestScanHwmonNotFound(t *testing.T) {
+
+	scanner := NewScanner()
+	scanner.Directory = "/sys/class/hwmon/"
+	scanner.FS = MemoryFileSystem{}
+
+	_, err := scanner.Scan()
+	if !errors.Is(err, ErrHwmonNotFound) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Scan() error = %v, want ErrHwmonNotFound and "+
+			"fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,315 @@
+package tempchk
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// MemorySymlinkPrefix marks an entry of a MemoryFileSystem as a symlink,
+// the rest of its contents being the target; e.g. "symlink:../../0000:00:18.3"
+const MemorySymlinkPrefix = "symlink:"
+
+// FileSystem is the subset of filesystem access needed to read sensors,
+// so that synthetic hwmon trees can be read in place of the real /sys.
+type FileSystem interface {
+
+	// reads the whole contents of the file at the given path
+	ReadFile(path string) ([]byte, error)
+
+	// lists the entries of the directory at the given path, sorted by name
+	ReadDir(path string) ([]os.FileInfo, error)
+
+	// describes the entry at the given path, without following a symlink
+	Lstat(path string) (os.FileInfo, error)
+
+	// obtains the target of the symlink at the given path
+	Readlink(path string) (string, error)
+}
+
+// OSFileSystem reads from the real filesystem of the operating system.
+type OSFileSystem struct{}
+
+//! Reads a file of the operating system.
+/*
+ * @param      string    path of the file
+ *
+ * @returns    byte[]    contents of the file
+ *             error     whether or not the file could be read
+ */
+func (OSFileSystem) ReadFile(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+//! Lists a directory of the operating system.
+/*
+ * @param      string          path of the directory
+ *
+ * @returns    os.FileInfo[]   entries of the directory, sorted by name
+ *             error           whether or not the directory could be read
+ */
+func (OSFileSystem) ReadDir(path string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(path)
+}
+
+//! Describes an entry of the operating system, without following symlinks.
+/*
+ * @param      string         path of the entry
+ *
+ * @returns    os.FileInfo    description of the entry
+ *             error          whether or not the entry exists
+ */
+func (OSFileSystem) Lstat(path string) (os.FileInfo, error) {
+	return os.Lstat(path)
+}
+
+//! Obtains the target of a symlink of the operating system.
+/*
+ * @param      string    path of the symlink
+ *
+ * @returns    string    target of the symlink, as given when created
+ *             error     whether or not the path is a readable symlink
+ */
+func (OSFileSystem) Readlink(path string) (string, error) {
+	return os.Readlink(path)
+}
+
+// MemoryFileSystem is an in-memory filesystem of file contents keyed by
+// their full path, e.g. "/sys/class/hwmon/hwmon0/name"; directories exist
+// implicitly, as long as they contain at least one file. Entries whose
+// contents start with MemorySymlinkPrefix are symlinks, which are only
+// followed by code that resolves them, e.g. via Lstat and Readlink.
+type MemoryFileSystem map[string]string
+
+//! Reads a file of the in-memory filesystem.
+/*
+ * @param      string    path of the file
+ *
+ * @returns    byte[]    contents of the file
+ *             error     whether or not the file exists
+ */
+func (m MemoryFileSystem) ReadFile(path string) ([]byte, error) {
+
+	contents, ok := m[path]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+
+	return []byte(contents), nil
+}
+
+//! Describes an entry of the in-memory filesystem, without following it.
+/*
+ * @param      string         path of the entry
+ *
+ * @returns    os.FileInfo    description of the entry
+ *             error          whether or not the entry exists
+ */
+func (m MemoryFileSystem) Lstat(path string) (os.FileInfo, error) {
+
+	path = strings.TrimSuffix(path, "/")
+	name := path[strings.LastIndex(path, "/")+1:]
+
+	if contents, ok := m[path]; ok {
+		return memoryFileInfo{
+			name:    name,
+			size:    int64(len(contents)),
+			symlink: strings.HasPrefix(contents, MemorySymlinkPrefix),
+		}, nil
+	}
+
+	// Directories only exist by way of the files within them.
+	for file := range m {
+		if strings.HasPrefix(file, path+"/") {
+			return memoryFileInfo{name: name, dir: true}, nil
+		}
+	}
+
+	return nil, &os.PathError{Op: "lstat", Path: path, Err: os.ErrNotExist}
+}
+
+//! Obtains the target of a symlink of the in-memory filesystem.
+/*
+ * @param      string    path of the symlink
+ *
+ * @returns    string    target of the symlink
+ *             error     whether or not the path is a symlink
+ */
+func (m MemoryFileSystem) Readlink(path string) (string, error) {
+
+	contents, ok := m[strings.TrimSuffix(path, "/")]
+	if !ok {
+		return "", &os.PathError{Op: "readlink", Path: path,
+			Err: os.ErrNotExist}
+	}
+
+	if !strings.HasPrefix(contents, MemorySymlinkPrefix) {
+		return "", &os.PathError{Op: "readlink", Path: path,
+			Err: syscall.EINVAL}
+	}
+
+	return strings.TrimPrefix(contents, MemorySymlinkPrefix), nil
+}
+
+//! Lists a directory of the in-memory filesystem.
+/*
+ * @param      string          path of the directory
+ *
+ * @returns    os.FileInfo[]   entries of the directory, sorted by name
+ *             error           whether or not the directory exists
+ */
+func (m MemoryFileSystem) ReadDir(path string) ([]os.FileInfo, error) {
+
+	prefix := strings.TrimSuffix(path, "/") + "/"
+
+	// Only the first path element below the directory is an entry of it.
+	entries := make(map[string]memoryFileInfo)
+	for file, contents := range m {
+
+		if !strings.HasPrefix(file, prefix) {
+			continue
+		}
+
+		name := strings.TrimPrefix(file, prefix)
+		if i := strings.Index(name, "/"); i >= 0 {
+			entries[name[:i]] = memoryFileInfo{name: name[:i], dir: true}
+			continue
+		}
+
+		entries[name] = memoryFileInfo{
+			name:    name,
+			size:    int64(len(contents)),
+			symlink: strings.HasPrefix(contents, MemorySymlinkPrefix),
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		infos = append(infos, entry)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	return infos, nil
+}
+
+// Description of a single entry of a MemoryFileSystem.
+type memoryFileInfo struct {
+
+	// name of the entry, without its directory
+	name string
+
+	// length of the file contents, in bytes
+	size int64
+
+	// whether or not the entry is a directory
+	dir bool
+
+	// whether or not the entry is a symlink
+	symlink bool
+}
+
+func (fi memoryFileInfo) Name() string       { return fi.name }
+func (fi memoryFileInfo) Size() int64        { return fi.size }
+func (fi memoryFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi memoryFileInfo) IsDir() bool        { return fi.dir }
+func (fi memoryFileInfo) Sys() interface{}   { return nil }
+
+func (fi memoryFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0555
+	}
+	if fi.symlink {
+		return os.ModeSymlink | 0777
+	}
+	return 0444
+}
+
+// Filesystem whose reads give up once its context is done, e.g. once the
+// deadline of a whole scan has passed, rather than carrying on reading.
+type contextFileSystem struct {
+	FileSystem
+	ctx context.Context
+}
+
+//! Wraps a filesystem so that its reads give up once the context is done.
+/*
+ * @param      Context       context to give up on the reads with
+ * @param      FileSystem    filesystem to read from
+ *
+ * @returns    FileSystem    filesystem bound to the context, or the given
+ *                           one as is if the context can never be done
+ */
+func withContext(ctx context.Context, fsys FileSystem) FileSystem {
+
+	if ctx.Done() == nil {
+		return fsys
+	}
+
+	return contextFileSystem{FileSystem: fsys, ctx: ctx}
+}
+
+//! Reads a file, unless the context is done before the read finishes.
+/*
+ * A hung read cannot be interrupted, so it is left to finish in the
+ * background, though no further reads are started once the context is
+ * done.
+ *
+ * @param      string    path of the file
+ *
+ * @returns    byte[]    contents of the file
+ *             error     whether or not the file could be read; the error of
+ *                       the context if it was done first
+ */
+func (c contextFileSystem) ReadFile(path string) ([]byte, error) {
+
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		data []byte
+		err  error
+	}
+
+	// buffered, so that the read exits once it finishes regardless
+	results := make(chan result, 1)
+	go func() {
+		data, err := c.FileSystem.ReadFile(path)
+		results <- result{data, err}
+	}()
+
+	select {
+	case r := <-results:
+		return r.data, r.err
+	case <-c.ctx.Done():
+		debug("Warning: gave up reading " + path + ", " + c.ctx.Err().Error())
+		return nil, c.ctx.Err()
+	}
+}
+
+//! Lists a directory, unless the context is already done.
+/*
+ * @param      string          path of the directory
+ *
+ * @returns    os.FileInfo[]   entries of the directory, sorted by name
+ *             error           whether or not the directory could be read
+ */
+func (c contextFileSystem) ReadDir(path string) ([]os.FileInfo, error) {
+
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.FileSystem.ReadDir(path)
+}
@@ -0,0 +1,206 @@
+package tempchk
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// synthetic hwmon tree shared by the MemoryFileSystem tests
+var memoryTree = MemoryFileSystem{
+	"/sys/class/hwmon/hwmon0/name":        "k10temp\n",
+	"/sys/class/hwmon/hwmon0/temp1_input": "45000\n",
+	"/sys/class/hwmon/hwmon0/device":      MemorySymlinkPrefix + "../../0000:00:18.3",
+	"/sys/class/hwmon/hwmon1/device/name": "nvme\n",
+}
+
+// Checks that files are read back exactly, and that absent ones are not.
+func TestMemoryFileSystemReadFile(t *testing.T) {
+
+	tests := []struct {
+		path     string
+		contents string
+		exists   bool
+	}{
+		{"/sys/class/hwmon/hwmon0/name", "k10temp\n", true},
+		{"/sys/class/hwmon/hwmon1/device/name", "nvme\n", true},
+		{"/sys/class/hwmon/hwmon0/temp2_input", "", false},
+		{"/sys/class/hwmon/hwmon0", "", false},
+	}
+
+	for _, test := range tests {
+
+		data, err := memoryTree.ReadFile(test.path)
+
+		if !test.exists {
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("ReadFile(%q) error = %v, want os.ErrNotExist",
+					test.path, err)
+			}
+			continue
+		}
+
+		if err != nil || string(data) != test.contents {
+			t.Errorf("ReadFile(%q) = %q, %v, want %q", test.path, data, err,
+				test.contents)
+		}
+	}
+}
+
+// Checks that only the immediate entries of a directory are listed.
+func TestMemoryFileSystemReadDir(t *testing.T) {
+
+	tests := []struct {
+		path    string
+		entries []string
+		exists  bool
+	}{
+		{"/sys/class/hwmon", []string{"hwmon0", "hwmon1"}, true},
+		{"/sys/class/hwmon/", []string{"hwmon0", "hwmon1"}, true},
+		{"/sys/class/hwmon/hwmon0",
+			[]string{"device", "name", "temp1_input"}, true},
+		{"/sys/class/hwmon/hwmon1", []string{"device"}, true},
+		{"/sys/class/thermal", nil, false},
+	}
+
+	for _, test := range tests {
+
+		infos, err := memoryTree.ReadDir(test.path)
+
+		if !test.exists {
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("ReadDir(%q) error = %v, want os.ErrNotExist",
+					test.path, err)
+			}
+			continue
+		}
+
+		if err != nil || len(infos) != len(test.entries) {
+			t.Errorf("ReadDir(%q) = %d entries, %v, want %v", test.path,
+				len(infos), err, test.entries)
+			continue
+		}
+
+		for i, info := range infos {
+			if info.Name() != test.entries[i] {
+				t.Errorf("ReadDir(%q)[%d] = %q, want %q", test.path, i,
+					info.Name(), test.entries[i])
+			}
+		}
+	}
+}
+
+// Checks that entries are described as files, directories or symlinks.
+func TestMemoryFileSystemLstat(t *testing.T) {
+
+	tests := []struct {
+		path    string
+		dir     bool
+		symlink bool
+		exists  bool
+	}{
+		{"/sys/class/hwmon/hwmon0/name", false, false, true},
+		{"/sys/class/hwmon/hwmon0", true, false, true},
+		{"/sys/class/hwmon/hwmon0/", true, false, true},
+		{"/sys/class/hwmon/hwmon0/device", false, true, true},
+		{"/sys/class/hwmon/hwmon1/device", true, false, true},
+		{"/sys/class/hwmon/hwmon2", false, false, false},
+	}
+
+	for _, test := range tests {
+
+		info, err := memoryTree.Lstat(test.path)
+
+		if !test.exists {
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Lstat(%q) error = %v, want os.ErrNotExist",
+					test.path, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Lstat(%q) error = %v", test.path, err)
+			continue
+		}
+
+		if info.IsDir() != test.dir ||
+			(info.Mode()&os.ModeSymlink != 0) != test.symlink {
+			t.Errorf("Lstat(%q) mode = %v, want dir %v, symlink %v",
+				test.path, info.Mode(), test.dir, test.symlink)
+		}
+	}
+}
+
+// Checks that symlink targets are given back, and other entries refused.
+func TestMemoryFileSystemReadlink(t *testing.T) {
+
+	tests := []struct {
+		path   string
+		target string
+		ok     bool
+	}{
+		{"/sys/class/hwmon/hwmon0/device", "../../0000:00:18.3", true},
+		{"/sys/class/hwmon/hwmon0/name", "", false},
+		{"/sys/class/hwmon/hwmon1/device", "", false},
+	}
+
+	for _, test := range tests {
+
+		target, err := memoryTree.Readlink(test.path)
+
+		if (err == nil) != test.ok || target != test.target {
+			t.Errorf("Readlink(%q) = %q, %v, want %q", test.path, target,
+				err, test.target)
+		}
+	}
+}
+
+// Checks that a filesystem bound to a context stops reading once it is
+// done, giving up on a hung read too, while one that can never be done is
+// read as is.
+func TestWithContext(t *testing.T) {
+
+	fsys := withContext(context.Background(), memoryTree)
+	if _, ok := fsys.(MemoryFileSystem); !ok {
+		t.Errorf("withContext() of context.Background() wrapped the " +
+			"filesystem, want it as is")
+	}
+
+	path := "/sys/class/hwmon/hwmon0/temp1_input"
+	hung := &blockingFileSystem{
+		MemoryFileSystem: memoryTree,
+		release:          make(chan struct{}),
+	}
+	defer close(hung.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		10*time.Millisecond)
+	defer cancel()
+
+	bound := withContext(ctx, hung)
+
+	_, err := bound.ReadFile(path)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ReadFile() of a hung file error = %v, want "+
+			"context.DeadlineExceeded", err)
+	}
+
+	// Once done, nothing more is read at all.
+	_, err = bound.ReadFile(path)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ReadFile() once done error = %v, want "+
+			"context.DeadlineExceeded", err)
+	}
+	_, err = bound.ReadDir("/sys/class/hwmon/hwmon0")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ReadDir() once done error = %v, want "+
+			"context.DeadlineExceeded", err)
+	}
+
+	if reads := hung.readCount(); reads != 1 {
+		t.Errorf("%d reads were started, want 1", reads)
+	}
+}
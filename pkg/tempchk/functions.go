@@ -0,0 +1,1021 @@
+package tempchk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//! Passes a debug message along to the debug function, if one is set.
+/*
+ * @param      string    message to pass along
+ *
+ * @returns    none
+ */
+func debug(debugMsg string) {
+
+	if DebugFunc == nil {
+		return
+	}
+
+	DebugFunc(debugMsg)
+}
+
+//! Reads a file, retrying a few times should the read fail transiently.
+/*
+ * Permanent errors, e.g. of a file that does not exist, and timed out
+ * reads are returned straight away, since retrying them cannot help.
+ *
+ * @param      FileSystem    filesystem to read from
+ * @param      string        path of the file
+ *
+ * @returns    byte[]        contents of the file
+ *             error         whether or not the file could be read
+ */
+func readFile(fsys FileSystem, path string) ([]byte, error) {
+
+	delay := ReadRetryDelay
+
+	for attempt := 1; ; attempt++ {
+
+		data, err := readFileWithTimeout(fsys, path)
+		if err == nil || !isTransientError(err) || attempt >= ReadAttempts {
+			return data, err
+		}
+
+		debug("Warning: reading " + path + " failed with " + err.Error() +
+			", retrying in " + delay.String())
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+//! Determines whether a read error is likely to go away if retried.
+/*
+ * @param      error    error of the failed read
+ *
+ * @returns    bool     whether or not the error is transient, e.g. EBUSY
+ */
+func isTransientError(err error) bool {
+	return errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.EINTR)
+}
+
+//! Reads a file, giving up on it once the read timeout has passed.
+/*
+ * Some flaky drivers block reads of their sensor files indefinitely. Such
+ * a read cannot be interrupted, so it is left to finish in the background;
+ * the result channel is buffered, so that goroutine exits once it does.
+ * Until then, later reads of the same file fail straight away with
+ * ErrReadTimeout, so that at most one reader per file is ever outstanding,
+ * rather than one more per scan, e.g. of -watch.
+ *
+ * @param      FileSystem    filesystem to read from
+ * @param      string        path of the file
+ *
+ * @returns    byte[]        contents of the file
+ *             error         whether or not the file could be read in time;
+ *                           ErrReadTimeout if the read timed out, or an
+ *                           earlier one has yet to finish
+ */
+func readFileWithTimeout(fsys FileSystem, path string) ([]byte, error) {
+
+	if ReadTimeout <= 0 {
+		return fsys.ReadFile(path)
+	}
+
+	type result struct {
+		data []byte
+		err  error
+	}
+
+	hungReadsMutex.Lock()
+	if hungReads[path] {
+		hungReadsMutex.Unlock()
+		debug("Warning: an earlier read of " + path + " has yet to " +
+			"finish. Skipping...")
+		return nil, ErrReadTimeout
+	}
+	hungReadsMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ReadTimeout)
+	defer cancel()
+
+	// closed once the read has finished, so that a timed out read can tell
+	// whether it is still outstanding
+	done := make(chan struct{})
+
+	results := make(chan result, 1)
+	go func() {
+		data, err := fsys.ReadFile(path)
+		results <- result{data, err}
+
+		hungReadsMutex.Lock()
+		close(done)
+		delete(hungReads, path)
+		hungReadsMutex.Unlock()
+	}()
+
+	select {
+	case r := <-results:
+		return r.data, r.err
+	case <-ctx.Done():
+		debug("Warning: reading " + path + " took longer than " +
+			ReadTimeout.String() + ". Skipping...")
+
+		// Mark the file as hung, unless the read finished just now.
+		hungReadsMutex.Lock()
+		select {
+		case <-done:
+		default:
+			hungReads[path] = true
+		}
+		hungReadsMutex.Unlock()
+
+		return nil, ErrReadTimeout
+	}
+}
+
+//! Reads the name file of a hwmon device, looking one level deeper if needed.
+/*
+ * On some device tree based systems the name file is not directly inside
+ * the hwmon directory, but rather in one of its sub-nodes.
+ *
+ * @param      string    hwmon directory to read from, e.g. /sys/class/hwmon/
+ * @param      string    hwmon directory of the device, e.g. hwmon0
+ *
+ * @returns    byte[]    contents of the name file
+ *             error     whether or not a name file could be read
+ */
+func ReadNameFile(directory string, hwmon string) ([]byte, error) {
+	return readNameFile(DefaultFileSystem, directory, hwmon)
+}
+
+//! Reads the name file of a hwmon device from the given filesystem.
+/*
+ * @param      FileSystem    filesystem to read from
+ * @param      string        hwmon directory to read from, e.g. /sys/class/hwmon/
+ * @param      string        hwmon directory of the device, e.g. hwmon0
+ *
+ * @returns    byte[]        contents of the name file
+ *             error         whether or not a name file could be read
+ */
+func readNameFile(fsys FileSystem, directory string,
+	hwmon string) ([]byte, error) {
+
+	rawData, err := fsys.ReadFile(directory + hwmon + "/" + HardwareNameFile)
+	if err == nil {
+		return rawData, nil
+	}
+
+	entries, dirErr := fsys.ReadDir(directory + hwmon)
+	if dirErr != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+
+		nestedPath := directory + hwmon + "/" + entry.Name() + "/" +
+			HardwareNameFile
+
+		nestedData, nestedErr := fsys.ReadFile(nestedPath)
+		if nestedErr != nil || len(nestedData) < 1 {
+			continue
+		}
+
+		debug("Using the nested name file of " + hwmon + " at " + nestedPath)
+
+		return nestedData, nil
+	}
+
+	return nil, err
+}
+
+//! Determines the fixed-point divisor of a given sensor category.
+/*
+ * @param      string    sensor category, e.g. temp or fan
+ *
+ * @returns    int       divisor to apply, or 1 if the category is unknown
+ */
+func CategoryDivisor(category string) int {
+
+	divisor, ok := categoryDivisors[category]
+	if !ok || divisor < 1 {
+		return 1
+	}
+
+	return divisor
+}
+
+//! Determines the unit of a given sensor category, once scaled.
+/*
+ * @param      string    sensor category, e.g. temp or fan
+ *
+ * @returns    string    unit, e.g. C or RPM, or blank if unknown
+ */
+func CategoryUnit(category string) string {
+	return categoryUnits[category]
+}
+
+//! Scales the value and limits of a sensor into human units.
+/*
+ * @param      Sensor    sensor with raw, unscaled values
+ * @param      int       divisor of the sensor's category
+ *
+ * @returns    Sensor    sensor with scaled values
+ */
+func ScaleSensor(sensor Sensor, divisor int) Sensor {
+
+	sensor.IntData /= divisor
+	sensor.Divisor = divisor
+
+	// Copy the limits, so as to not alter those of the original sensor.
+	limits := make(map[string]int, len(sensor.Limits))
+	for suffix, limit := range sensor.Limits {
+		limits[suffix] = limit / divisor
+	}
+	sensor.Limits = limits
+
+	return sensor
+}
+
+//! Determines whether a temperature sensor exceeds its max or crit limit.
+/*
+ * @param      Sensor    sensor to check, with its limits scaled alike
+ *
+ * @returns    bool      whether or not the sensor is over either limit;
+ *                       sensors without limit files are never over
+ */
+func OverTemperature(sensor Sensor) bool {
+
+	if sensor.Category != TempPrefix {
+		return false
+	}
+
+	for _, suffix := range []string{MaxSuffix, CritSuffix} {
+		limit, ok := sensor.Limits[suffix]
+		if ok && sensor.IntData > limit {
+			return true
+		}
+	}
+
+	return false
+}
+
+//! Determines whether a temperature is within the plausible range.
+/*
+ * @param      Sensor    sensor to check, with its value scaled to degrees
+ *                       Celsius
+ *
+ * @returns    bool      whether or not the value could be a real reading;
+ *                       sensors other than temperatures always are
+ */
+func PlausibleTemperature(sensor Sensor) bool {
+
+	if sensor.Category != TempPrefix {
+		return true
+	}
+
+	return sensor.IntData >= MinPlausibleTemperature &&
+		sensor.IntData <= MaxPlausibleTemperature
+}
+
+//! Reads an attribute file of a hwmon device, e.g. temp1_label.
+/*
+ * @param      string    hwmon directory of the device, e.g. hwmon0
+ * @param      string    name of the attribute file, e.g. temp1_label
+ *
+ * @returns    string    trimmed contents of the attribute
+ *             error     whether or not the attribute could be read
+ */
+func ReadAttribute(hwmon string, attribute string) (string, error) {
+	return readAttribute(DefaultFileSystem, HardwareMonitorDirectory, hwmon,
+		attribute)
+}
+
+//! Reads an attribute file of a device in the given hwmon directory.
+/*
+ * @param      FileSystem    filesystem to read from
+ * @param      string        hwmon directory to read from, e.g. /sys/class/hwmon/
+ * @param      string        hwmon directory of the device, e.g. hwmon0
+ * @param      string        name of the attribute file, e.g. temp1_label
+ *
+ * @returns    string        trimmed contents of the attribute
+ *             error         whether or not the attribute could be read
+ */
+func readAttribute(fsys FileSystem, directory string, hwmon string,
+	attribute string) (string, error) {
+
+	// input validation
+	if directory == "" || hwmon == "" || attribute == "" {
+		return "", fmt.Errorf("ReadAttribute(): %w", ErrInvalidInput)
+	}
+
+	return readAttributeFile(fsys, directory+hwmon+"/"+attribute)
+}
+
+//! Reads an attribute file at the given path.
+/*
+ * @param      FileSystem    filesystem to read from
+ * @param      string        path of the attribute file, e.g.
+ *                           /sys/class/hwmon/hwmon0/temp1_label
+ *
+ * @returns    string        trimmed contents of the attribute
+ *             error         whether or not the attribute could be read
+ */
+func readAttributeFile(fsys FileSystem, path string) (string, error) {
+
+	rawData, err := readFile(fsys, path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(rawData)), nil
+}
+
+//! Reads a 0/1 flag file at the given path, e.g. that of temp1_alarm.
+/*
+ * @param      FileSystem    filesystem to read from
+ * @param      string        path of the flag file
+ *
+ * @returns    bool          whether or not the flag is set; absent or
+ *                           non-boolean files count as unset
+ */
+func readFlagFile(fsys FileSystem, path string) bool {
+
+	value, err := readAttributeFile(fsys, path)
+	if err != nil || value != "1" {
+		return false
+	}
+
+	debug("Flag is set in " + path)
+
+	return true
+}
+
+//! Reads a boolean 0/1 attribute file of a hwmon device, e.g. temp1_alarm.
+/*
+ * @param      string    hwmon directory of the device, e.g. hwmon0
+ * @param      string    name of the attribute file, e.g. beep_enable
+ *
+ * @returns    bool      value of the attribute
+ *             error     whether or not the attribute is present and boolean
+ */
+func ReadBoolAttribute(hwmon string, attribute string) (bool, error) {
+	return readBoolAttribute(DefaultFileSystem, HardwareMonitorDirectory, hwmon,
+		attribute)
+}
+
+//! Reads a boolean attribute file of a device in the given hwmon directory.
+/*
+ * @param      FileSystem    filesystem to read from
+ * @param      string        hwmon directory to read from, e.g. /sys/class/hwmon/
+ * @param      string        hwmon directory of the device, e.g. hwmon0
+ * @param      string        name of the attribute file, e.g. beep_enable
+ *
+ * @returns    bool          value of the attribute
+ *             error         whether or not the attribute is present and boolean
+ */
+func readBoolAttribute(fsys FileSystem, directory string, hwmon string,
+	attribute string) (bool, error) {
+
+	value, err := readAttribute(fsys, directory, hwmon, attribute)
+	if err != nil {
+		return false, err
+	}
+
+	switch value {
+	case "0":
+		return false, nil
+	case "1":
+		debug("Flag is set in " + hwmon + "/" + attribute)
+		return true, nil
+	}
+
+	return false, fmt.Errorf("ReadBoolAttribute(): %s/%s does not contain "+
+		"a boolean value", hwmon, attribute)
+}
+
+//! Reads the PWM duty cycle of a fan, e.g. that of pwm1 for fan1.
+/*
+ * @param      string    hwmon directory of the device, e.g. hwmon0
+ * @param      int       number of the fan, e.g. 1 for fan1
+ *
+ * @returns    int       duty cycle, as a percentage of full duty
+ *             error     whether or not the fan has a readable duty cycle
+ */
+func ReadFanPWM(hwmon string, number int) (int, error) {
+	return readFanPWM(DefaultFileSystem, HardwareMonitorDirectory, hwmon,
+		number)
+}
+
+//! Reads the PWM duty cycle of a fan of a device in the given directory.
+/*
+ * @param      FileSystem    filesystem to read from
+ * @param      string        hwmon directory to read from, e.g. /sys/class/hwmon/
+ * @param      string        hwmon directory of the device, e.g. hwmon0
+ * @param      int           number of the fan, e.g. 1 for fan1
+ *
+ * @returns    int           duty cycle, as a percentage of full duty
+ *             error         whether or not the fan has a readable duty
+ *                           cycle
+ */
+func readFanPWM(fsys FileSystem, directory string, hwmon string,
+	number int) (int, error) {
+
+	attribute := PwmPrefix + strconv.Itoa(number)
+
+	value, err := readAttribute(fsys, directory, hwmon, attribute)
+	if err != nil {
+		return 0, err
+	}
+
+	duty, err := strconv.Atoi(value)
+	if err != nil || duty < 0 || duty > MaxPWM {
+		return 0, fmt.Errorf("ReadFanPWM(): %s/%s does not contain a "+
+			"duty cycle", hwmon, attribute)
+	}
+
+	// Round to the nearest percent, so that e.g. 128 is 50%.
+	return (duty*100 + MaxPWM/2) / MaxPWM, nil
+}
+
+//! Reads how a fan is controlled, e.g. that of pwm1_enable for fan1.
+/*
+ * @param      string    hwmon directory of the device, e.g. hwmon0
+ * @param      int       number of the fan, e.g. 1 for fan1
+ *
+ * @returns    string    control mode: full speed, manual or automatic
+ *             error     whether or not the fan has a readable control mode
+ */
+func ReadFanControlMode(hwmon string, number int) (string, error) {
+	return readFanControlMode(DefaultFileSystem, HardwareMonitorDirectory,
+		hwmon, number)
+}
+
+//! Reads how a fan of a device in the given directory is controlled.
+/*
+ * @param      FileSystem    filesystem to read from
+ * @param      string        hwmon directory to read from, e.g. /sys/class/hwmon/
+ * @param      string        hwmon directory of the device, e.g. hwmon0
+ * @param      int           number of the fan, e.g. 1 for fan1
+ *
+ * @returns    string        control mode: full speed, manual or automatic
+ *             error         whether or not the fan has a readable control
+ *                           mode
+ */
+func readFanControlMode(fsys FileSystem, directory string, hwmon string,
+	number int) (string, error) {
+
+	attribute := PwmPrefix + strconv.Itoa(number) + EnableSuffix
+
+	value, err := readAttribute(fsys, directory, hwmon, attribute)
+	if err != nil {
+		return "", err
+	}
+
+	mode, err := strconv.Atoi(value)
+	if err != nil || mode < 0 {
+		return "", fmt.Errorf("ReadFanControlMode(): %s/%s does not "+
+			"contain a control mode", hwmon, attribute)
+	}
+
+	if name, ok := pwmModes[mode]; ok {
+		return name, nil
+	}
+
+	// Drivers number their automatic modes differently, e.g. 2 to 5.
+	return "automatic", nil
+}
+
+//! Obtains hwmon sensor data.
+/*
+ * @param      string    name of device
+ * @param      string    full path of the given hwmon directory
+ *
+ * @returns    Sensor    sensor data object
+ *             error     whether or not the output is feasible
+ */
+func GetSensorData(name string, hwmon string) ([]Sensor, error) {
+	return GetSensorDataByCategory(name, hwmon, TempPrefix, InputSuffix)
+}
+
+//! Obtains hwmon fan data.
+/*
+ * @param      string    name of device
+ * @param      string    hwmon directory of the device, e.g. hwmon0
+ *
+ * @returns    Sensor    fan sensor data objects, in RPM
+ *             error     whether or not the output is feasible
+ */
+func GetFanData(name string, hwmon string) ([]Sensor, error) {
+	return GetSensorDataByCategory(name, hwmon, FanPrefix, InputSuffix)
+}
+
+//! Obtains hwmon sensor data of a given category.
+/*
+ * @param      string    name of device
+ * @param      string    hwmon directory of the device, e.g. hwmon0
+ * @param      string    sensor category prefix, e.g. temp, fan, in, curr
+ * @param      string    attribute suffix of the value files, e.g. _input
+ *
+ * @returns    Sensor    sensor data objects of the given category
+ *             error     whether or not the output is feasible
+ */
+func GetSensorDataByCategory(name string, hwmon string, prefix string,
+	suffix string) ([]Sensor, error) {
+	return ReadSensors(HardwareMonitorDirectory, name, hwmon, prefix, suffix)
+}
+
+//! Obtains the data of one category of sensors of a hwmon device.
+/*
+ * @param      string    hwmon directory to read from, e.g. /sys/class/hwmon/
+ * @param      string    name of device
+ * @param      string    hwmon directory of the device, e.g. hwmon0
+ * @param      string    sensor category prefix, e.g. temp
+ * @param      string    attribute suffix of the value files, e.g. _input
+ *
+ * @returns    Sensor    sensor data object
+ *             error     whether or not the output is feasible
+ */
+func ReadSensors(directory string, name string, hwmon string,
+	prefix string, suffix string) ([]Sensor, error) {
+	return readSensors(DefaultFileSystem, directory, name, hwmon, prefix,
+		suffix)
+}
+
+//! Obtains the data of one category of sensors from the given filesystem.
+/*
+ * @param      FileSystem    filesystem to read from
+ * @param      string        hwmon directory to read from, e.g. /sys/class/hwmon/
+ * @param      string        name of device
+ * @param      string        hwmon directory of the device, e.g. hwmon0
+ * @param      string        sensor category prefix, e.g. temp
+ * @param      string        attribute suffix of the value files, e.g. _input
+ *
+ * @returns    Sensor        sensor data object
+ *             error         whether or not the output is feasible
+ */
+func readSensors(fsys FileSystem, directory string, name string,
+	hwmon string, prefix string, suffix string) ([]Sensor, error) {
+
+	// input validation
+	if directory == "" || name == "" || hwmon == "" || prefix == "" ||
+		suffix == "" {
+		return make([]Sensor, 0), fmt.Errorf("GetSensorDataByCategory(): "+
+			"%w", ErrInvalidInput)
+	}
+
+	sensors, reason := walkSensors(fsys, directory, name, hwmon, prefix,
+		suffix)
+	if len(sensors) == 0 {
+		return sensors, fmt.Errorf("GetSensorDataByCategory(): %w",
+			NewCausedError(ErrNoSensors, "no valid "+prefix+" sensors",
+				reason))
+	}
+
+	return sensors, nil
+}
+
+//! Obtains the data of every sensor of a hwmon device, of any category.
+/*
+ * @param      string    name of device
+ * @param      string    hwmon directory of the device, e.g. hwmon0
+ *
+ * @returns    Sensor    sensor data objects, grouped by category and in
+ *                       the order of their numbers
+ *             error     whether or not the output is feasible
+ */
+func ScanDevice(name string, hwmon string) ([]Sensor, error) {
+	return ScanDeviceContext(context.Background(), name, hwmon)
+}
+
+//! Obtains the data of every sensor of a hwmon device, of any category,
+//! giving up on the remaining reads once the context is done.
+/*
+ * @param      Context    context of the scan, e.g. with its deadline
+ * @param      string     name of device
+ * @param      string     hwmon directory of the device, e.g. hwmon0
+ *
+ * @returns    Sensor     sensor data objects read before the context was
+ *                        done, grouped by category and in the order of
+ *                        their numbers
+ *             error      whether or not the output is feasible
+ */
+func ScanDeviceContext(ctx context.Context, name string,
+	hwmon string) ([]Sensor, error) {
+	return scanDevice(withContext(ctx, DefaultFileSystem),
+		HardwareMonitorDirectory, name, hwmon)
+}
+
+//! Obtains the data of every sensor of a hwmon device from the given filesystem.
+/*
+ * @param      FileSystem    filesystem to read from
+ * @param      string        hwmon directory to read from, e.g. /sys/class/hwmon/
+ * @param      string        name of device
+ * @param      string        hwmon directory of the device, e.g. hwmon0
+ *
+ * @returns    Sensor        sensor data objects, grouped by category and
+ *                           in the order of their numbers
+ *             error         whether or not the output is feasible
+ */
+func scanDevice(fsys FileSystem, directory string, name string,
+	hwmon string) ([]Sensor, error) {
+
+	// input validation
+	if directory == "" || name == "" || hwmon == "" {
+		return make([]Sensor, 0), fmt.Errorf("ScanDevice(): %w",
+			ErrInvalidInput)
+	}
+
+	sensors, reason := walkSensors(fsys, directory, name, hwmon, "",
+		InputSuffix)
+	if len(sensors) == 0 {
+		return sensors, fmt.Errorf("ScanDevice(): %w",
+			NewCausedError(ErrNoSensors, "no valid sensors", reason))
+	}
+
+	return sensors, nil
+}
+
+//! Reads every sensor of a device whose value file has the given suffix.
+/*
+ * The device directory is listed just once, rather than checking for each
+ * possible sensor number, and the category of each sensor is inferred from
+ * the prefix of its file name; e.g. temp of temp1_input.
+ *
+ * @param      FileSystem    filesystem to read from
+ * @param      string        hwmon directory to read from, e.g. /sys/class/hwmon/
+ * @param      string        name of device
+ * @param      string        hwmon directory of the device, e.g. hwmon0
+ * @param      string        sensor category prefix to keep, e.g. temp;
+ *                           blank keeps every category
+ * @param      string        attribute suffix of the value files, e.g. _input
+ *
+ * @returns    Sensor[]      sensors read, grouped by category and in the
+ *                           order of their numbers
+ *             error         if there are no sensors, the reason why; e.g.
+ *                           ErrNoInputFiles
+ */
+func walkSensors(fsys FileSystem, directory string, name string,
+	hwmon string, prefix string, suffix string) ([]Sensor, error) {
+
+	sensors := make([]Sensor, 0)
+
+	files, err := fsys.ReadDir(directory + hwmon)
+	if err != nil {
+		return sensors, NewCausedError(ErrInputUnreadable,
+			"unable to list "+directory+hwmon, err)
+	}
+
+	// Shared by the paths of every sensor, so only assembled the once.
+	deviceDirectory := directory + hwmon + "/"
+
+	// why the sensors that could not be read failed, if any did
+	reason := ErrNoInputFiles
+
+	for _, file := range files {
+
+		if file.IsDir() || !strings.HasSuffix(file.Name(), suffix) {
+			continue
+		}
+
+		// Split e.g. temp1_input into its category and number; numbering
+		// may have gaps, e.g. temp1, temp2 and temp4, and voltage sensors
+		// start at in0.
+		attributePrefix := strings.TrimSuffix(file.Name(), suffix)
+		i := strings.IndexAny(attributePrefix, "0123456789")
+		if i < 1 {
+			continue
+		}
+
+		category := attributePrefix[:i]
+		if prefix != "" && category != prefix {
+			continue
+		}
+
+		number, err := strconv.Atoi(attributePrefix[i:])
+		if err != nil || number > MaxSensorNumber {
+			continue
+		}
+
+		sensor, err := readSensor(fsys, deviceDirectory, name, hwmon,
+			category, number, suffix)
+		if err != nil {
+
+			// A lack of permission is the most telling of the reasons.
+			if !errors.Is(reason, ErrInputPermission) {
+				reason = err
+			}
+			continue
+		}
+
+		sensors = append(sensors, sensor)
+	}
+
+	// The directory is listed by name, so e.g. temp10 comes before temp2.
+	sort.SliceStable(sensors, func(i, j int) bool {
+		if sensors[i].Category != sensors[j].Category {
+			return sensors[i].Category < sensors[j].Category
+		}
+		return sensors[i].Number < sensors[j].Number
+	})
+
+	// Now that every sensor has been found, record how many there are of
+	// each category.
+	counts := make(map[string]int)
+	for _, sensor := range sensors {
+		counts[sensor.Category]++
+	}
+	for i := range sensors {
+		sensors[i].Count = counts[sensors[i].Category]
+	}
+
+	if len(sensors) > 0 {
+		reason = nil
+	}
+
+	return sensors, reason
+}
+
+//! Reads a single sensor of a hwmon device, along with its attributes.
+/*
+ * @param      FileSystem    filesystem to read from
+ * @param      string        directory of the device, with a trailing slash;
+ *                           e.g. /sys/class/hwmon/hwmon0/
+ * @param      string        name of device
+ * @param      string        hwmon directory of the device, e.g. hwmon0
+ * @param      string        sensor category prefix, e.g. temp
+ * @param      int           number of the sensor, e.g. 1 for temp1
+ * @param      string        attribute suffix of the value file, e.g. _input
+ *
+ * @returns    Sensor        sensor data object
+ *             error         why the sensor has no valid reading, if it has
+ *                           none; e.g. ErrInputPermission
+ */
+func readSensor(fsys FileSystem, deviceDirectory string, name string,
+	hwmon string, prefix string, number int, suffix string) (Sensor, error) {
+
+	// Assemble the filepath to the input file of the currently
+	// given hardware device; the other attributes of the sensor share
+	// all but the suffix of it, e.g. temp1_label.
+	attributePath := deviceDirectory + prefix + strconv.Itoa(number)
+	path := attributePath + suffix
+
+	// Mention any sensors that exist but may not be read.
+	rawData, err := readFile(fsys, path)
+	if errors.Is(err, os.ErrPermission) {
+		debug("Warning: permission denied reading " + path + ", try " +
+			"running with elevated privileges to read the " + prefix +
+			" sensors of " + hwmon + " (" + name + ")")
+		return Sensor{}, NewCausedError(ErrInputPermission,
+			"unable to read "+path, err)
+	}
+	if err != nil {
+		return Sensor{}, NewCausedError(ErrInputUnreadable,
+			"unable to read "+path, err)
+	}
+	if len(rawData) < 1 {
+		return Sensor{}, ErrInputUnparseable
+	}
+
+	// Skip assembling the messages when nobody would see them, since
+	// this runs for every sensor of every scan.
+	if DebugFunc != nil {
+		debug("Opened " + hwmon + " file at:\n" + path)
+
+		debug("Converting " + prefix + " file data from " +
+			hwmon + " into a string.")
+	}
+
+	// Attempt to convert the reading to a string, trim it, and then
+	// to an integer value afterwards. No category has a minimum valid
+	// reading, so zero and negative ones are kept alike; e.g. an ambient
+	// sensor in the cold, a stopped fan, an unused voltage rail or the
+	// -12 V one, or a current flowing backwards.
+	trimmedIntData, err := strconv.Atoi(strings.TrimSpace(string(rawData)))
+	if err != nil {
+		return Sensor{}, NewCausedError(ErrInputUnparseable,
+			"unable to parse "+path, err)
+	}
+
+	// Check whether the hardware has flagged this sensor; most drivers
+	// lack alarm and fault files, in which case they are considered unset.
+	alarm := readFlagFile(fsys, attributePath+AlarmSuffix)
+	fault := readFlagFile(fsys, attributePath+FaultSuffix)
+
+	// Labels are optional, and on some chips do not follow the sensor
+	// numbering; e.g. temp7 of an nct6798 could be AUXTIN0.
+	label, _ := readAttributeFile(fsys, attributePath+LabelSuffix)
+
+	// Read whichever limits this category has, skipping absent ones.
+	limits := make(map[string]int, len(categoryLimitSuffixes[prefix]))
+	for _, suffix := range categoryLimitSuffixes[prefix] {
+
+		value, err := readAttributeFile(fsys, attributePath+suffix)
+		if err != nil {
+			continue
+		}
+
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+
+		limits[suffix] = limit
+	}
+
+	return Sensor{
+		Device:   hwmon,
+		Name:     name,
+		Label:    label,
+		Path:     path,
+		Category: prefix,
+		IntData:  trimmedIntData,
+		RawData:  trimmedIntData,
+		Number:   number,
+		Alarm:    alarm,
+		Fault:    fault,
+		Limits:   limits,
+	}, nil
+}
+
+//! Reads the type of a thermal zone, which serves as its name.
+/*
+ * @param      string    thermal zone directory to read from, e.g.
+ *                       /sys/class/thermal/
+ * @param      string    thermal zone, e.g. thermal_zone0
+ *
+ * @returns    string    trimmed type of the zone, e.g. cpu-thermal
+ *             error     whether or not the type could be read
+ */
+func ReadThermalZoneType(directory string, zone string) (string, error) {
+	return readAttribute(DefaultFileSystem, directory, zone,
+		ThermalZoneTypeFile)
+}
+
+//! Obtains the temperature of a thermal zone, as a hwmon-alike sensor.
+/*
+ * @param      string    thermal zone directory to read from, e.g.
+ *                       /sys/class/thermal/
+ * @param      string    name of the zone, as per its type file
+ * @param      string    thermal zone, e.g. thermal_zone0
+ *
+ * @returns    Sensor    temperature sensor of the zone, unscaled
+ *             error     whether or not the output is feasible
+ */
+func ReadThermalZone(directory string, name string,
+	zone string) ([]Sensor, error) {
+	return ReadThermalZoneContext(context.Background(), directory, name, zone)
+}
+
+//! Obtains the temperature of a thermal zone, as a hwmon-alike sensor,
+//! unless the context is done first.
+/*
+ * @param      Context    context of the scan, e.g. with its deadline
+ * @param      string     thermal zone directory to read from, e.g.
+ *                        /sys/class/thermal/
+ * @param      string     name of the zone, as per its type file
+ * @param      string     thermal zone, e.g. thermal_zone0
+ *
+ * @returns    Sensor     temperature sensor of the zone, unscaled
+ *             error      whether or not the output is feasible
+ */
+func ReadThermalZoneContext(ctx context.Context, directory string,
+	name string, zone string) ([]Sensor, error) {
+	return readThermalZone(withContext(ctx, DefaultFileSystem), directory,
+		name, zone)
+}
+
+//! Obtains the temperature of a thermal zone from the given filesystem.
+/*
+ * @param      FileSystem    filesystem to read from
+ * @param      string        thermal zone directory to read from, e.g.
+ *                           /sys/class/thermal/
+ * @param      string        name of the zone, as per its type file
+ * @param      string        thermal zone, e.g. thermal_zone0
+ *
+ * @returns    Sensor        temperature sensor of the zone, unscaled
+ *             error         whether or not the output is feasible
+ */
+func readThermalZone(fsys FileSystem, directory string, name string,
+	zone string) ([]Sensor, error) {
+
+	sensors := make([]Sensor, 0)
+
+	// input validation
+	if directory == "" || name == "" || zone == "" {
+		return sensors, fmt.Errorf("ReadThermalZone(): %w", ErrInvalidInput)
+	}
+
+	// A zone has a single temperature, in millidegrees like temp1_input.
+	value, err := readAttribute(fsys, directory, zone, ThermalZoneTempFile)
+	if err != nil {
+		return sensors, fmt.Errorf("ReadThermalZone(): unable to read "+
+			"the temperature of %s, %w", zone, err)
+	}
+
+	intData, err := strconv.Atoi(value)
+	if err != nil {
+		return sensors, fmt.Errorf("ReadThermalZone(): %w",
+			NewCausedError(ErrNoSensors, "invalid temperature of "+zone,
+				ErrInputUnparseable))
+	}
+
+	sensors = append(sensors, Sensor{
+		Device:   zone,
+		Name:     name,
+		Path:     directory + zone + "/" + ThermalZoneTempFile,
+		Category: TempPrefix,
+		IntData:  intData,
+		RawData:  intData,
+		Number:   1,
+		Count:    1,
+		Limits:   make(map[string]int),
+	})
+
+	return sensors, nil
+}
+
+//! Determines whether the CPU is a Ryzen, as per the CPU info file.
+/*
+ * @returns    bool    whether or not the CPU is a Ryzen
+ */
+func CPUIsRyzen() bool {
+	return cpuIsRyzen(DefaultFileSystem)
+}
+
+//! Determines whether the CPU is a Ryzen, as per the given filesystem.
+/*
+ * @param      FileSystem    filesystem to read the CPU info file from
+ *
+ * @returns    bool          whether or not the CPU is a Ryzen
+ */
+func cpuIsRyzen(fsys FileSystem) bool {
+
+	//
+	// attempt to read from the CPU info file to determine if Ryzen
+	//
+
+	cpuinfoFileAsBytes, err := fsys.ReadFile(CpuinfoFile)
+	if len(cpuinfoFileAsBytes) == 0 || err != nil {
+		return false
+	}
+
+	cpuinfoString := string(cpuinfoFileAsBytes)
+	if cpuinfoString == "" {
+		return false
+	}
+
+	return strings.Contains(cpuinfoString, "Ryzen")
+}
+
+//! Collapses sensors of a device that appear to be aliases of one another.
+/*
+ * Some chips expose the same physical sensor under several tempN_input
+ * files. Since there is no reliable way to detect this, sensors of the
+ * same category and label that report an identical raw value are assumed
+ * to be aliases, and are merged into the lowest numbered sensor.
+ *
+ * @param      Sensor[]    sensors of a single device
+ *
+ * @returns    Sensor[]    sensors with the duplicates removed
+ */
+func MergeDuplicateSensors(sensors []Sensor) []Sensor {
+
+	merged := make([]Sensor, 0, len(sensors))
+
+	for _, sensor := range sensors {
+
+		duplicate := false
+		for i := range merged {
+			if merged[i].Name == sensor.Name &&
+				merged[i].Category == sensor.Category &&
+				merged[i].Label == sensor.Label &&
+				merged[i].IntData == sensor.IntData {
+
+				debug("Merging " + sensor.Category +
+					strconv.Itoa(sensor.Number) + " of " + sensor.Name +
+					" into " + sensor.Category +
+					strconv.Itoa(merged[i].Number))
+
+				merged[i].Aliases = append(merged[i].Aliases, sensor.Number)
+				duplicate = true
+				break
+			}
+		}
+
+		if !duplicate {
+			merged = append(merged, sensor)
+		}
+	}
+
+	return merged
+}
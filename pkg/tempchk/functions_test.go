@@ -0,0 +1,534 @@
+package tempchk
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Assembles a synthetic device of the given number of temp and fan
+// sensors, each with a label and limits, as found on larger boards.
+func largeDevice(count int) MemoryFileSystem {
+
+	files := MemoryFileSystem{"/sys/class/hwmon/hwmon0/name": "nct6799\n"}
+
+	for i := 1; i <= count; i++ {
+		temp := "/sys/class/hwmon/hwmon0/temp" + strconv.Itoa(i)
+		files[temp+"_input"] = strconv.Itoa(30000+i*1000) + "\n"
+		files[temp+"_label"] = "AUXTIN" + strconv.Itoa(i) + "\n"
+		files[temp+"_max"] = "90000\n"
+		files[temp+"_crit"] = "100000\n"
+		files[temp+"_alarm"] = strconv.Itoa(i%2) + "\n"
+
+		fan := "/sys/class/hwmon/hwmon0/fan" + strconv.Itoa(i)
+		files[fan+"_input"] = strconv.Itoa(1000+i*10) + "\n"
+		files[fan+"_min"] = "300\n"
+	}
+
+	return files
+}
+
+// Checks that every sensor of a large device is read with all of its
+// attributes, exactly as before the paths were shared between them.
+func TestScanDeviceLargeDevice(t *testing.T) {
+
+	sensors, err := scanDevice(largeDevice(30), "/sys/class/hwmon/",
+		"nct6799", "hwmon0")
+	if err != nil || len(sensors) != 60 {
+		t.Fatalf("scanDevice() = %d sensors, %v, want 60", len(sensors), err)
+	}
+
+	// Fans sort before temperatures, each in the order of their numbers.
+	for i := 1; i <= 30; i++ {
+
+		fan := sensors[i-1]
+		want := Sensor{
+			Device:   "hwmon0",
+			Name:     "nct6799",
+			Path:     "/sys/class/hwmon/hwmon0/fan" + strconv.Itoa(i) + "_input",
+			Category: FanPrefix,
+			IntData:  1000 + i*10,
+			RawData:  1000 + i*10,
+			Number:   i,
+			Count:    30,
+			Limits:   map[string]int{MinSuffix: 300},
+		}
+		if !reflect.DeepEqual(fan, want) {
+			t.Errorf("fan%d = %+v, want %+v", i, fan, want)
+		}
+
+		temp := sensors[30+i-1]
+		want = Sensor{
+			Device:   "hwmon0",
+			Name:     "nct6799",
+			Label:    "AUXTIN" + strconv.Itoa(i),
+			Path:     "/sys/class/hwmon/hwmon0/temp" + strconv.Itoa(i) + "_input",
+			Category: TempPrefix,
+			IntData:  30000 + i*1000,
+			RawData:  30000 + i*1000,
+			Number:   i,
+			Count:    30,
+			Alarm:    i%2 == 1,
+			Limits:   map[string]int{MaxSuffix: 90000, CritSuffix: 100000},
+		}
+		if !reflect.DeepEqual(temp, want) {
+			t.Errorf("temp%d = %+v, want %+v", i, temp, want)
+		}
+	}
+}
+
+// Measures a scan of a large device; compare allocations via -benchmem.
+func BenchmarkScanDevice(b *testing.B) {
+
+	files := largeDevice(30)
+	timeout := ReadTimeout
+	ReadTimeout = 0
+	defer func() { ReadTimeout = timeout }()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := scanDevice(files, "/sys/class/hwmon/", "nct6799", "hwmon0")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// MemoryFileSystem whose reads block until released, counting how many
+// have been started.
+type blockingFileSystem struct {
+	MemoryFileSystem
+	release chan struct{}
+
+	mutex sync.Mutex
+	reads int
+}
+
+func (b *blockingFileSystem) ReadFile(path string) ([]byte, error) {
+
+	b.mutex.Lock()
+	b.reads++
+	b.mutex.Unlock()
+
+	<-b.release
+
+	return b.MemoryFileSystem.ReadFile(path)
+}
+
+func (b *blockingFileSystem) readCount() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.reads
+}
+
+// Checks that a hung file is not read again until its earlier read finishes,
+// so that at most one reader per file is outstanding.
+func TestReadFileWithTimeoutHungFile(t *testing.T) {
+
+	timeout := ReadTimeout
+	ReadTimeout = 10 * time.Millisecond
+	defer func() { ReadTimeout = timeout }()
+
+	path := "/sys/class/hwmon/hwmon0/temp1_input"
+	fsys := &blockingFileSystem{
+		MemoryFileSystem: MemoryFileSystem{path: "45000\n"},
+		release:          make(chan struct{}),
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := readFileWithTimeout(fsys, path)
+		if !errors.Is(err, ErrReadTimeout) {
+			t.Fatalf("read %d error = %v, want ErrReadTimeout", i, err)
+		}
+	}
+
+	if reads := fsys.readCount(); reads != 1 {
+		t.Errorf("%d reads were started of the hung file, want 1", reads)
+	}
+
+	// Once the hung read finishes, the file may be read again.
+	close(fsys.release)
+	for deadline := time.Now().Add(time.Second); ; {
+
+		hungReadsMutex.Lock()
+		hung := hungReads[path]
+		hungReadsMutex.Unlock()
+
+		if !hung {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the hung read of %s never finished", path)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	data, err := readFileWithTimeout(fsys, path)
+	if err != nil || string(data) != "45000\n" {
+		t.Errorf("readFileWithTimeout() = %q, %v, want 45000", data, err)
+	}
+}
+
+// Checks that the alarm and fault flags of a sensor are read as set only
+// if their file is present and set, and that sensors without them are
+// still read.
+func TestScanDeviceAlarmAndFault(t *testing.T) {
+
+	sensors, err := scanDevice(MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "nct6798\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "45000\n",
+		"/sys/class/hwmon/hwmon0/temp2_input": "95000\n",
+		"/sys/class/hwmon/hwmon0/temp2_alarm": "1\n",
+		"/sys/class/hwmon/hwmon0/temp2_fault": "0\n",
+		"/sys/class/hwmon/hwmon0/temp3_input": "-128000\n",
+		"/sys/class/hwmon/hwmon0/temp3_alarm": "0\n",
+		"/sys/class/hwmon/hwmon0/temp3_fault": "1\n",
+		"/sys/class/hwmon/hwmon0/temp4_input": "40000\n",
+		"/sys/class/hwmon/hwmon0/temp4_alarm": "0\n",
+		"/sys/class/hwmon/hwmon0/temp4_fault": "0\n",
+		"/sys/class/hwmon/hwmon0/temp5_input": "40000\n",
+		"/sys/class/hwmon/hwmon0/temp5_alarm": "\n",
+		"/sys/class/hwmon/hwmon0/temp5_fault": "2\n",
+	}, "/sys/class/hwmon/", "nct6798", "hwmon0")
+
+	want := []struct {
+		alarm bool
+		fault bool
+	}{
+		{false, false},
+		{true, false},
+		{false, true},
+		{false, false},
+		{false, false},
+	}
+
+	if err != nil || len(sensors) != len(want) {
+		t.Fatalf("scanDevice() = %+v, %v, want %d sensors", sensors, err,
+			len(want))
+	}
+
+	for i, test := range want {
+		if sensors[i].Alarm != test.alarm || sensors[i].Fault != test.fault {
+			t.Errorf("temp%d alarm %v, fault %v, want alarm %v, fault %v",
+				sensors[i].Number, sensors[i].Alarm, sensors[i].Fault,
+				test.alarm, test.fault)
+		}
+	}
+}
+
+// Checks that boolean attributes read as 0 or 1, and that anything else,
+// or an absent file, is an error rather than false.
+func TestReadBoolAttribute(t *testing.T) {
+
+	fsys := MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/beep_enable": "1\n",
+		"/sys/class/hwmon/hwmon0/temp1_beep":  "0\n",
+		"/sys/class/hwmon/hwmon0/temp2_beep":  "2\n",
+		"/sys/class/hwmon/hwmon0/temp3_beep":  "yes\n",
+		"/sys/class/hwmon/hwmon0/temp4_beep":  "\n",
+	}
+
+	tests := []struct {
+		attribute string
+		value     bool
+		ok        bool
+	}{
+		{"beep_enable", true, true},
+		{"temp1_beep", false, true},
+		{"temp2_beep", false, false},
+		{"temp3_beep", false, false},
+		{"temp4_beep", false, false},
+		{"temp5_beep", false, false},
+	}
+
+	for _, test := range tests {
+
+		value, err := readBoolAttribute(fsys, "/sys/class/hwmon/", "hwmon0",
+			test.attribute)
+
+		if (err == nil) != test.ok || value != test.value {
+			t.Errorf("readBoolAttribute(%q) = %v, %v, want %v and an error "+
+				"%v", test.attribute, value, err, test.value, !test.ok)
+		}
+	}
+
+	// An absent file is told apart from one with an invalid value.
+	_, err := readBoolAttribute(fsys, "/sys/class/hwmon/", "hwmon0",
+		"temp5_beep")
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("readBoolAttribute() of an absent file error = %v, want "+
+			"os.ErrNotExist", err)
+	}
+}
+
+// Checks the fixed-point scale of each category against the kernel hwmon
+// sysfs ABI, since a wrong one silently gives wrong readings.
+func TestCategoryDivisor(t *testing.T) {
+
+	tests := []struct {
+		category string
+		divisor  int
+	}{
+		{TempPrefix, 1000},
+		{VoltagePrefix, 1000},
+		{FanPrefix, 1},
+		{CurrentPrefix, 1000},
+		{PowerPrefix, 1000000},
+		{"energy", 1000000},
+		{"humidity", 1000},
+		{PwmPrefix, 1},
+		{"", 1},
+	}
+
+	for _, test := range tests {
+		if divisor := CategoryDivisor(test.category); divisor != test.divisor {
+			t.Errorf("CategoryDivisor(%q) = %d, want %d", test.category,
+				divisor, test.divisor)
+		}
+	}
+}
+
+// Checks that zero and negative readings of every category are kept as
+// valid, e.g. of an ambient sensor in the cold or a stopped fan, rather than
+// taken for missing sensors.
+func TestScanDeviceZeroAndNegativeReadings(t *testing.T) {
+
+	sensors, err := scanDevice(MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":         "nct6798\n",
+		"/sys/class/hwmon/hwmon0/temp1_input":  "-5000\n",
+		"/sys/class/hwmon/hwmon0/temp2_input":  "0\n",
+		"/sys/class/hwmon/hwmon0/temp3_input":  "-1000\n",
+		"/sys/class/hwmon/hwmon0/temp4_input":  "-40000\n",
+		"/sys/class/hwmon/hwmon0/fan1_input":   "0\n",
+		"/sys/class/hwmon/hwmon0/in0_input":    "0\n",
+		"/sys/class/hwmon/hwmon0/in1_input":    "1\n",
+		"/sys/class/hwmon/hwmon0/in2_input":    "-12096\n",
+		"/sys/class/hwmon/hwmon0/curr1_input":  "0\n",
+		"/sys/class/hwmon/hwmon0/curr2_input":  "-250\n",
+		"/sys/class/hwmon/hwmon0/power1_input": "0\n",
+	}, "/sys/class/hwmon/", "nct6798", "hwmon0")
+
+	want := []struct {
+		category string
+		number   int
+		value    string
+	}{
+		{CurrentPrefix, 1, "0.000"},
+		{CurrentPrefix, 2, "-0.250"},
+		{FanPrefix, 1, "0"},
+		{VoltagePrefix, 0, "0.000"},
+		{VoltagePrefix, 1, "0.001"},
+		{VoltagePrefix, 2, "-12.096"},
+		{PowerPrefix, 1, "0.0"},
+		{TempPrefix, 1, "-5"},
+		{TempPrefix, 2, "0"},
+		{TempPrefix, 3, "-1"},
+		{TempPrefix, 4, "-40"},
+	}
+
+	if err != nil || len(sensors) != len(want) {
+		t.Fatalf("scanDevice() = %+v, %v, want %d sensors", sensors, err,
+			len(want))
+	}
+
+	for i, test := range want {
+
+		sensor := ScaleSensor(sensors[i], CategoryDivisor(sensors[i].Category))
+		if sensor.Category != test.category || sensor.Number != test.number ||
+			sensor.FormatValue() != test.value || !PlausibleTemperature(sensor) {
+			t.Errorf("sensor %d = %s%d of %s, plausible %v, want a "+
+				"plausible %s%d of %s", i, sensor.Category, sensor.Number,
+				sensor.FormatValue(), PlausibleTemperature(sensor), test.category,
+				test.number, test.value)
+		}
+	}
+}
+
+// MemoryFileSystem whose reads fail with each of the given errors in turn,
+// before succeeding, counting how many have been attempted.
+type flakyFileSystem struct {
+	MemoryFileSystem
+	errs  []error
+	reads int
+}
+
+func (f *flakyFileSystem) ReadFile(path string) ([]byte, error) {
+
+	f.reads++
+	if f.reads <= len(f.errs) {
+		return nil, &os.PathError{Op: "read", Path: path,
+			Err: f.errs[f.reads-1]}
+	}
+
+	return f.MemoryFileSystem.ReadFile(path)
+}
+
+// Checks that only transient read errors are retried, and only as many
+// times as configured.
+func TestReadFileRetries(t *testing.T) {
+
+	attempts, delay := ReadAttempts, ReadRetryDelay
+	ReadRetryDelay = time.Microsecond
+	defer func() { ReadAttempts, ReadRetryDelay = attempts, delay }()
+
+	path := "/sys/class/hwmon/hwmon0/temp1_input"
+
+	tests := []struct {
+		name     string
+		attempts int
+		errs     []error
+		reads    int
+		err      error
+	}{
+		{"transient then success", 3, []error{syscall.EBUSY}, 2, nil},
+		{"retried until success", 3,
+			[]error{syscall.EAGAIN, syscall.EINTR}, 3, nil},
+		{"single attempt", 1, []error{syscall.EBUSY}, 1, syscall.EBUSY},
+		{"attempts exhausted", 3, []error{syscall.EBUSY, syscall.EBUSY,
+			syscall.EBUSY}, 3, syscall.EBUSY},
+		{"not retried", 3, []error{syscall.ENOENT}, 1, os.ErrNotExist},
+	}
+
+	for _, test := range tests {
+
+		ReadAttempts = test.attempts
+		fsys := &flakyFileSystem{
+			MemoryFileSystem: MemoryFileSystem{path: "45000\n"},
+			errs:             test.errs,
+		}
+
+		data, err := readFile(fsys, path)
+
+		if fsys.reads != test.reads {
+			t.Errorf("%s: %d reads were attempted, want %d", test.name,
+				fsys.reads, test.reads)
+		}
+
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("%s: readFile() error = %v, want %v", test.name,
+					err, test.err)
+			}
+			continue
+		}
+
+		if err != nil || string(data) != "45000\n" {
+			t.Errorf("%s: readFile() = %q, %v, want 45000", test.name, data,
+				err)
+		}
+	}
+}
+
+// Checks that the name file is read directly from the device if present,
+// else from one of its sub-nodes, e.g. device/name.
+func TestReadNameFile(t *testing.T) {
+
+	fsys := MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "k10temp\n",
+		"/sys/class/hwmon/hwmon0/device/name": "pci\n",
+		"/sys/class/hwmon/hwmon1/device/name": "nvme\n",
+		"/sys/class/hwmon/hwmon2/temp1_input": "45000\n",
+	}
+
+	tests := []struct {
+		hwmon string
+		name  string
+		ok    bool
+	}{
+		{"hwmon0", "k10temp\n", true},
+		{"hwmon1", "nvme\n", true},
+		{"hwmon2", "", false},
+		{"hwmon3", "", false},
+	}
+
+	for _, test := range tests {
+
+		data, err := readNameFile(fsys, "/sys/class/hwmon/", test.hwmon)
+
+		if !test.ok {
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("readNameFile(%q) error = %v, want os.ErrNotExist",
+					test.hwmon, err)
+			}
+			continue
+		}
+
+		if err != nil || string(data) != test.name {
+			t.Errorf("readNameFile(%q) = %q, %v, want %q", test.hwmon, data,
+				err, test.name)
+		}
+	}
+}
+
+// Checks that tab, CR and CRLF line endings, as some drivers give, are
+// trimmed from readings, labels and device names alike.
+func TestTrimmedAttributes(t *testing.T) {
+
+	for _, ending := range []string{"\t", "\r", "\r\n", " \t\r\n"} {
+
+		scanner := NewScanner()
+		scanner.Directory = "/sys/class/hwmon/"
+		scanner.K10tempOffset = 0
+		scanner.FS = MemoryFileSystem{
+			"/sys/class/hwmon/hwmon0/name":        "k10temp" + ending,
+			"/sys/class/hwmon/hwmon0/temp1_input": "45000" + ending,
+			"/sys/class/hwmon/hwmon0/temp1_label": "Tctl" + ending,
+		}
+
+		sensors, err := scanner.Scan()
+		if err != nil || len(sensors) != 1 {
+			t.Errorf("%q: Scan() = %+v, %v, want one sensor", ending,
+				sensors, err)
+			continue
+		}
+
+		if sensors[0].Name != "k10temp" || sensors[0].Label != "Tctl" ||
+			sensors[0].IntData != 45 {
+			t.Errorf("%q: temp1 = %q %q %d, want \"k10temp\" \"Tctl\" 45",
+				ending, sensors[0].Name, sensors[0].Label, sensors[0].IntData)
+		}
+	}
+}
+
+// Checks that only sensors of the same category, label and value are merged,
+// into the lowest numbered of them.
+func TestMergeDuplicateSensors(t *testing.T) {
+
+	sensor := func(category string, number int, label string,
+		value int) Sensor {
+		return Sensor{Device: "hwmon0", Name: "nct6798", Category: category,
+			Number: number, Label: label, IntData: value, RawData: value}
+	}
+
+	merged := sensor(TempPrefix, 1, "SYSTIN", 35000)
+	merged.Aliases = []int{3, 7}
+
+	sensors := MergeDuplicateSensors([]Sensor{
+		sensor(TempPrefix, 1, "SYSTIN", 35000),
+		sensor(TempPrefix, 2, "CPUTIN", 35000),
+		sensor(TempPrefix, 3, "SYSTIN", 35000),
+		sensor(TempPrefix, 4, "SYSTIN", 36000),
+		sensor(TempPrefix, 5, "", 35000),
+		sensor(FanPrefix, 1, "SYSTIN", 35000),
+		sensor(TempPrefix, 7, "SYSTIN", 35000),
+	})
+
+	want := []Sensor{
+		merged,
+		sensor(TempPrefix, 2, "CPUTIN", 35000),
+		sensor(TempPrefix, 4, "SYSTIN", 36000),
+		sensor(TempPrefix, 5, "", 35000),
+		sensor(FanPrefix, 1, "SYSTIN", 35000),
+	}
+
+	if !reflect.DeepEqual(sensors, want) {
+		t.Errorf("MergeDuplicateSensors() = %+v, want %+v", sensors, want)
+	}
+}
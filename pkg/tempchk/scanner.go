@@ -0,0 +1,136 @@
+package tempchk
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Scanner holds the configuration needed to repeatedly scan hwmon sensors,
+// independently of the command line flags and globals.
+type Scanner struct {
+
+	// hwmon directory to scan, including the trailing slash
+	Directory string
+
+	// degrees added to k10temp readings, when the AMD digital power
+	// module is not in use
+	K10tempOffset int
+
+	// sensor categories to read; e.g. temp or fan
+	Categories []string
+
+	// filesystem to read from; the real one if nil
+	FS FileSystem
+
+	// per-chip divisors that replace the category defaults, keyed by
+	// chip:category; e.g. nct6798:in
+	Divisors map[string]int
+}
+
+//! Creates a Scanner with the default configuration.
+/*
+ * @returns    Scanner    scanner of the temperature sensors
+ */
+func NewScanner() *Scanner {
+	return &Scanner{
+		Directory:     HardwareMonitorDirectory,
+		K10tempOffset: 30,
+		Categories:    []string{TempPrefix},
+	}
+}
+
+//! Scans the configured hwmon directory once.
+/*
+ * @returns    Sensor[]    sensors of every device, with scaled values
+ *             error       whether or not the scan is feasible
+ */
+func (s *Scanner) Scan() ([]Sensor, error) {
+
+	sensors := make([]Sensor, 0)
+
+	// input validation
+	if s.Directory == "" || len(s.Categories) < 1 {
+		return sensors, fmt.Errorf("Scan(): %w, the configuration lacks "+
+			"a directory or categories", ErrInvalidInput)
+	}
+
+	fsys := s.FS
+	if fsys == nil {
+		fsys = DefaultFileSystem
+	}
+
+	dirs, err := fsys.ReadDir(s.Directory)
+	if err != nil {
+		return sensors, fmt.Errorf("Scan(): %w", NewCausedError(
+			ErrHwmonNotFound, "unable to read "+s.Directory, err))
+	}
+
+	// Read the name of every device first, since the presence of the
+	// 'fam15h_power' module affects how k10temp readings are corrected.
+	names := make(map[string]string)
+	found := make([]string, 0, len(dirs))
+
+	for _, dir := range dirs {
+
+		rawName, err := readNameFile(fsys, s.Directory, dir.Name())
+		if err != nil {
+			continue
+		}
+
+		name := strings.TrimSpace(string(rawName))
+		if name == "" {
+			continue
+		}
+
+		names[dir.Name()] = name
+		found = append(found, name)
+	}
+
+	corrections := Corrections{
+		K10tempOffset:              s.K10tempOffset,
+		DigitalAmdPowerModuleInUse: digitalAmdPowerModuleInUse(fsys, found),
+	}
+
+	for _, dir := range dirs {
+
+		name, ok := names[dir.Name()]
+		if !ok {
+			continue
+		}
+
+		deviceSensors, err := scanDevice(fsys, s.Directory, name,
+			dir.Name())
+		if err != nil {
+			continue
+		}
+
+		for _, category := range s.Categories {
+
+			// Devices rarely provide every category, so skip the sensors
+			// of any others.
+			for _, sensor := range deviceSensors {
+
+				if sensor.Category != category {
+					continue
+				}
+
+				divisor, ok := s.Divisors[name+":"+category]
+				if !ok {
+					divisor = CategoryDivisor(category)
+				}
+
+				sensor = corrections.CorrectSensor(ScaleSensor(sensor,
+					divisor))
+
+				sensors = append(sensors, sensor)
+			}
+		}
+	}
+
+	if len(sensors) == 0 {
+		return sensors, fmt.Errorf("Scan(): %w in %s", ErrNoSensors,
+			strings.TrimSuffix(s.Directory, "/"))
+	}
+
+	return sensors, nil
+}
@@ -0,0 +1,152 @@
+package tempchk
+
+import (
+	"errors"
+	"testing"
+)
+
+// Checks that the Scanner corrects k10temp readings, and their limits, only
+// when the AMD digital power module is not in use.
+func TestScannerCorrections(t *testing.T) {
+
+	k10temp := MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "k10temp\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "45125\n",
+		"/sys/class/hwmon/hwmon0/temp1_max":   "70000\n",
+	}
+
+	tests := []struct {
+		name   string
+		extra  map[string]string
+		offset int
+		value  int
+		max    int
+	}{
+		{"offset", nil, 30, 75, 100},
+		{"no offset", nil, 0, 45, 70},
+		{"fam15h_power", map[string]string{
+			"/sys/class/hwmon/hwmon1/name": "fam15h_power\n",
+		}, 30, 45, 70},
+		{"ryzen", map[string]string{
+			CpuinfoFile: "model name\t: AMD Ryzen 7 5800X\n",
+		}, 30, 45, 70},
+	}
+
+	for _, test := range tests {
+
+		files := MemoryFileSystem{}
+		for path, contents := range k10temp {
+			files[path] = contents
+		}
+		for path, contents := range test.extra {
+			files[path] = contents
+		}
+
+		scanner := NewScanner()
+		scanner.Directory = "/sys/class/hwmon/"
+		scanner.FS = files
+		scanner.K10tempOffset = test.offset
+
+		sensors, err := scanner.Scan()
+		if err != nil || len(sensors) != 1 {
+			t.Errorf("%s: Scan() = %+v, %v, want one sensor", test.name,
+				sensors, err)
+			continue
+		}
+
+		if sensors[0].IntData != test.value ||
+			sensors[0].Limits[MaxSuffix] != test.max {
+			t.Errorf("%s: temp1 = %d C, max %d C, want %d C, max %d C",
+				test.name, sensors[0].IntData, sensors[0].Limits[MaxSuffix],
+				test.value, test.max)
+		}
+	}
+}
+
+// Checks that the Scanner corrects the same chips as the CLI would, via
+// the shared correction table, and leaves other chips alone.
+func TestScannerMatchesCorrections(t *testing.T) {
+
+	scanner := NewScanner()
+	scanner.Directory = "/sys/class/hwmon/"
+	scanner.FS = MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "k10temp\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "45000\n",
+		"/sys/class/hwmon/hwmon1/name":        "nvme\n",
+		"/sys/class/hwmon/hwmon1/temp1_input": "38000\n",
+	}
+
+	sensors, err := scanner.Scan()
+	if err != nil || len(sensors) != 2 {
+		t.Fatalf("Scan() = %+v, %v, want two sensors", sensors, err)
+	}
+
+	corrections := Corrections{K10tempOffset: scanner.K10tempOffset}
+	for i, raw := range []int{45, 38} {
+		want := corrections.CorrectTemperature(sensors[i].Name, raw)
+		if sensors[i].IntData != want {
+			t.Errorf("%s temp1 = %d C, want %d C", sensors[i].Name,
+				sensors[i].IntData, want)
+		}
+	}
+}
+
+// Checks that only the configured categories are kept, scaled by any
+// per-chip divisor.
+func TestScannerCategoriesAndDivisors(t *testing.T) {
+
+	scanner := NewScanner()
+	scanner.Directory = "/sys/class/hwmon/"
+	scanner.Categories = []string{FanPrefix, VoltagePrefix}
+	scanner.Divisors = map[string]int{"nct6798:in": 500}
+	scanner.FS = MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "nct6798\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "40000\n",
+		"/sys/class/hwmon/hwmon0/fan1_input":  "1200\n",
+		"/sys/class/hwmon/hwmon0/in0_input":   "1000\n",
+	}
+
+	sensors, err := scanner.Scan()
+	if err != nil || len(sensors) != 2 {
+		t.Fatalf("Scan() = %+v, %v, want a fan and a voltage", sensors, err)
+	}
+
+	if sensors[0].Category != FanPrefix || sensors[0].IntData != 1200 {
+		t.Errorf("sensors[0] = %+v, want fan1 of 1200 RPM", sensors[0])
+	}
+
+	if sensors[1].Category != VoltagePrefix || sensors[1].IntData != 2 {
+		t.Errorf("sensors[1] = %+v, want in0 of 2 V", sensors[1])
+	}
+}
+
+// Checks that each way a scan can fail is told apart by its sentinel.
+func TestScannerErrors(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		scanner  Scanner
+		sentinel error
+	}{
+		{"no directory", Scanner{Categories: []string{TempPrefix},
+			FS: MemoryFileSystem{}}, ErrInvalidInput},
+		{"no categories", Scanner{Directory: "/sys/class/hwmon/",
+			FS: MemoryFileSystem{}}, ErrInvalidInput},
+		{"no hwmon directory", Scanner{Directory: "/sys/class/hwmon/",
+			Categories: []string{TempPrefix}, FS: MemoryFileSystem{}},
+			ErrHwmonNotFound},
+		{"no sensors", Scanner{Directory: "/sys/class/hwmon/",
+			Categories: []string{TempPrefix}, FS: MemoryFileSystem{
+				"/sys/class/hwmon/hwmon0/name": "acpitz\n",
+			}}, ErrNoSensors},
+	}
+
+	for _, test := range tests {
+
+		_, err := test.scanner.Scan()
+		if !errors.Is(err, test.sentinel) {
+			t.Errorf("%s: Scan() error = %v, want %v", test.name, err,
+				test.sentinel)
+		}
+	}
+}
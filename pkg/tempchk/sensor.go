@@ -0,0 +1,206 @@
+package tempchk
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// Sensor holds a single reading of a hwmon sensor.
+type Sensor struct {
+
+	// hwmon directory of the device of the sensor; e.g. hwmon0
+	Device string
+
+	// name of sensor
+	Name string
+
+	// label of the sensor, as per its label file; e.g. Tctl or AUXTIN0
+	Label string
+
+	// location to the OS path
+	Path string
+
+	// sensor type; e.g. temp for Temperature sensors or fan for Fan sensors
+	Category string
+
+	// refined sensor data, as an int
+	IntData int
+
+	// raw sensor data, exactly as read from the input file
+	RawData int
+
+	// divisor the raw data was scaled by; 0 if not yet scaled
+	Divisor int
+
+	// current sensor number, for a given category, for a given hwmon; e.g. temp sensor 3 of a device with 5 temp sensors
+	Number int
+
+	// maximum number of sensors, for a given category, for a given hwmon
+	Count int
+
+	// whether the hardware has flagged this sensor as exceeding its limit
+	Alarm bool
+
+	// whether the hardware has reported this sensor as faulty
+	Fault bool
+
+	// whether the value is outside the plausible range of its category
+	Implausible bool
+
+	// unit the value was converted to, if not that of its category; e.g.
+	// F for a temperature in Fahrenheit
+	Unit string
+
+	// limits of the sensor, keyed by attribute suffix; e.g. _min
+	Limits map[string]int
+
+	// numbers of other sensors that were merged into this one as duplicates
+	Aliases []int
+}
+
+// Marshalable form of a sensor.
+type jsonSensor struct {
+
+	// hwmon directory of the device; e.g. hwmon0
+	Device string `json:"device"`
+
+	// name of the chip, as per its hardware name file; e.g. k10temp
+	Chip string `json:"chip"`
+
+	// label of the sensor, if it has one; e.g. Tctl
+	SensorLabel string `json:"sensor_label,omitempty"`
+
+	// sensor type; e.g. temp or fan
+	Category string `json:"category"`
+
+	// current sensor number, for a given category
+	Number int `json:"number"`
+
+	// corrected sensor value; fractional for categories such as in
+	Value float64 `json:"value"`
+
+	// unit of the value; e.g. C or RPM
+	Unit string `json:"unit"`
+
+	// whether the hardware has flagged the sensor; left out when the
+	// sensor is not in alarm or has no alarm file
+	Alarm bool `json:"alarm,omitempty"`
+
+	// whether the hardware has reported the sensor as faulty
+	Fault bool `json:"fault,omitempty"`
+
+	// whether the value is outside the plausible range of its category
+	Implausible bool `json:"implausible,omitempty"`
+}
+
+//! Determines the value of the sensor, keeping the fraction if it has one.
+/*
+ * @returns    float64    corrected value, fractional for categories such
+ *                        as in, else the whole number value
+ */
+func (s Sensor) Value() float64 {
+
+	if _, ok := categoryPrecisions[s.Category]; !ok || s.Divisor < 1 {
+		return float64(s.IntData)
+	}
+
+	return float64(s.RawData) / float64(s.Divisor)
+}
+
+//! Formats the value of the sensor.
+/*
+ * @returns    string    value, e.g. 45 or 1.104
+ */
+func (s Sensor) FormatValue() string {
+
+	precision, ok := categoryPrecisions[s.Category]
+	if !ok {
+		return strconv.Itoa(s.IntData)
+	}
+
+	return strconv.FormatFloat(s.Value(), 'f', precision, 64)
+}
+
+//! Formats the sensor as a human-readable line.
+/*
+ * @returns    string    device, name, value and unit; e.g.
+ *                       "hwmon0 k10temp 45 C"
+ */
+func (s Sensor) String() string {
+	return s.Device + " " + s.Name + " " + s.FormatValue() + " " + s.unit()
+}
+
+//! Determines the unit of the value of the sensor.
+/*
+ * @returns    string    unit it was converted to, if any, else that of its
+ *                       category; e.g. C
+ */
+func (s Sensor) unit() string {
+
+	if s.Unit != "" {
+		return s.Unit
+	}
+
+	return CategoryUnit(s.Category)
+}
+
+//! Marshals the sensor as a JSON object.
+/*
+ * @returns    byte[]    JSON object with lowercase keys, e.g. "value"
+ *             error     error message, if any
+ */
+func (s Sensor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonSensor{
+		Device:      s.Device,
+		Chip:        s.Name,
+		SensorLabel: s.Label,
+		Category:    s.Category,
+		Number:      s.Number,
+		Value:       s.Value(),
+		Unit:        s.unit(),
+		Alarm:       s.Alarm,
+		Fault:       s.Fault,
+		Implausible: s.Implausible,
+	})
+}
+
+//! Unmarshals the sensor from a JSON object, as given by MarshalJSON.
+/*
+ * Fractional values, e.g. of in sensors, are kept as their raw data, so
+ * that they marshal back unchanged; whole ones are truncated.
+ *
+ * @param      byte[]    JSON object of the sensor
+ *
+ * @returns    error     error message, if any
+ */
+func (s *Sensor) UnmarshalJSON(data []byte) error {
+
+	var j jsonSensor
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	*s = Sensor{
+		Device:      j.Device,
+		Name:        j.Chip,
+		Label:       j.SensorLabel,
+		Category:    j.Category,
+		Number:      j.Number,
+		IntData:     int(j.Value),
+		Alarm:       j.Alarm,
+		Fault:       j.Fault,
+		Implausible: j.Implausible,
+	}
+
+	if j.Unit != CategoryUnit(j.Category) {
+		s.Unit = j.Unit
+	}
+
+	if _, ok := categoryPrecisions[j.Category]; ok {
+		s.Divisor = CategoryDivisor(j.Category)
+		s.RawData = int(math.Round(j.Value * float64(s.Divisor)))
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package tempchk
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// scaled sensors of each category shared by the Sensor tests
+var (
+	tempSensor = ScaleSensor(Sensor{Device: "hwmon0", Name: "k10temp",
+		Label: "Tctl", Category: TempPrefix, Number: 1, IntData: 45125,
+		RawData: 45125, Alarm: true}, 1000)
+
+	fanSensor = ScaleSensor(Sensor{Device: "hwmon1", Name: "it8792",
+		Category: FanPrefix, Number: 2, IntData: 1200, RawData: 1200}, 1)
+
+	voltageSensor = ScaleSensor(Sensor{Device: "hwmon2", Name: "nct6798",
+		Category: VoltagePrefix, Number: 0, IntData: 1104,
+		RawData: 1104}, 1000)
+)
+
+// Checks the human-readable form of a sensor of each category.
+func TestSensorString(t *testing.T) {
+
+	converted := tempSensor
+	converted.IntData = 113
+	converted.Unit = "F"
+
+	tests := []struct {
+		sensor Sensor
+		text   string
+	}{
+		{tempSensor, "hwmon0 k10temp 45 C"},
+		{converted, "hwmon0 k10temp 113 F"},
+		{fanSensor, "hwmon1 it8792 1200 RPM"},
+		{voltageSensor, "hwmon2 nct6798 1.104 V"},
+	}
+
+	for _, test := range tests {
+		if text := test.sensor.String(); text != test.text {
+			t.Errorf("String() = %q, want %q", text, test.text)
+		}
+	}
+}
+
+// Checks the JSON form of a sensor of each category, leaving out the flags
+// that are not set.
+func TestSensorMarshalJSON(t *testing.T) {
+
+	tests := []struct {
+		sensor Sensor
+		json   string
+	}{
+		{tempSensor, `{"device":"hwmon0","chip":"k10temp",` +
+			`"sensor_label":"Tctl","category":"temp","number":1,` +
+			`"value":45,"unit":"C","alarm":true}`},
+		{fanSensor, `{"device":"hwmon1","chip":"it8792","category":"fan",` +
+			`"number":2,"value":1200,"unit":"RPM"}`},
+		{voltageSensor, `{"device":"hwmon2","chip":"nct6798",` +
+			`"category":"in","number":0,"value":1.104,"unit":"V"}`},
+	}
+
+	for _, test := range tests {
+
+		data, err := json.Marshal(test.sensor)
+		if err != nil || string(data) != test.json {
+			t.Errorf("json.Marshal(%s) = %s, %v, want %s", test.sensor,
+				data, err, test.json)
+		}
+	}
+}
+
+// Checks that a sensor unmarshals back into one that marshals the same, so
+// that -json output can be read back, e.g. as a baseline.
+func TestSensorJSONRoundTrip(t *testing.T) {
+
+	converted := tempSensor
+	converted.IntData = 318
+	converted.Unit = "K"
+	converted.Fault = true
+	converted.Implausible = true
+
+	for _, sensor := range []Sensor{tempSensor, converted, fanSensor,
+		voltageSensor} {
+
+		data, err := json.Marshal(sensor)
+		if err != nil {
+			t.Fatalf("json.Marshal(%s) error = %v", sensor, err)
+		}
+
+		var decoded Sensor
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Errorf("json.Unmarshal(%s) error = %v", data, err)
+			continue
+		}
+
+		again, err := json.Marshal(decoded)
+		if err != nil || string(again) != string(data) {
+			t.Errorf("round trip of %s gave %s, %v", data, again, err)
+		}
+
+		if decoded.String() != sensor.String() {
+			t.Errorf("round trip of %q gave %q", sensor, decoded)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Package tempchk reads the hardware sensors exposed by the Linux hwmon
+// sysfs interface, e.g. temperatures and fan speeds.
+package tempchk
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Attribute file prefixes and suffixes of the hwmon sensor categories.
+const (
+	// Attribute file prefix for temperature sensors.
+	TempPrefix = "temp"
+
+	// Attribute file prefix for fan sensors.
+	FanPrefix = "fan"
+
+	// Attribute file prefixes for voltage, current and power sensors.
+	VoltagePrefix = "in"
+	CurrentPrefix = "curr"
+	PowerPrefix   = "power"
+
+	// Attribute file suffix for storing the current value of a sensor.
+	InputSuffix = "_input"
+
+	// Attribute file suffix for storing the label of a sensor.
+	LabelSuffix = "_label"
+
+	// Attribute file suffix for storing whether the hardware has tripped
+	// an alarm.
+	AlarmSuffix = "_alarm"
+
+	// Attribute file suffix for storing whether the hardware reports a
+	// faulty sensor.
+	FaultSuffix = "_fault"
+
+	// Attribute file suffixes for storing the low, high and critical
+	// temperature limits of a sensor.
+	MinSuffix  = "_min"
+	MaxSuffix  = "_max"
+	CritSuffix = "_crit"
+
+	// Attribute file prefix for the PWM duty cycle of a fan, e.g. pwm1,
+	// which ranges from 0 to MaxPWM.
+	PwmPrefix = "pwm"
+	MaxPWM    = 255
+
+	// Attribute file suffix for storing how a fan is controlled, e.g.
+	// pwm1_enable.
+	EnableSuffix = "_enable"
+
+	// Range of temperatures, in degrees Celsius, that a real sensor could
+	// plausibly report; anything outside it is likely a driver bug, e.g.
+	// a sign or scaling error.
+	MinPlausibleTemperature = -40
+	MaxPlausibleTemperature = 150
+)
+
+// Globals
+var (
+	// Current location of the hardware sensor data, as of kernel 4.4+
+	HardwareMonitorDirectory = "/sys/class/hwmon/"
+
+	// cpu info location, as of kernel 4.4+
+	CpuinfoFile = "/proc/cpuinfo"
+
+	// Attribute file for storing the hardware device name.
+	HardwareNameFile = "name"
+
+	// Location of the thermal zones, which some boards expose instead of
+	// hwmon devices
+	ThermalZoneDirectory = "/sys/class/thermal/"
+
+	// Directory prefix of each thermal zone; e.g. thermal_zone0
+	ThermalZonePrefix = "thermal_zone"
+
+	// Files of a thermal zone for storing its name and its temperature,
+	// in millidegrees Celsius
+	ThermalZoneTypeFile = "type"
+	ThermalZoneTempFile = "temp"
+
+	// highest sensor number checked for, per category, of each device
+	MaxSensorNumber = 32
+
+	// filesystem read by the package-level functions; e.g. the real /sys
+	DefaultFileSystem FileSystem = OSFileSystem{}
+
+	// longest a single sensor file read may take; 0 means no limit
+	ReadTimeout = time.Duration(0)
+
+	// error returned by a read that exceeded the read timeout
+	ErrReadTimeout = errors.New("readFile(): read timed out")
+
+	// paths of the files whose reads timed out and have yet to finish,
+	// guarded by hungReadsMutex
+	hungReads      = make(map[string]bool)
+	hungReadsMutex sync.Mutex
+
+	// Reasons why a device has no valid sensors, as wrapped by the errors
+	// of the sensor-reading functions; check for them with errors.Is.
+	ErrNoInputFiles     = errors.New("no input files found")
+	ErrInputPermission  = errors.New("permission denied reading the input files")
+	ErrInputUnreadable  = errors.New("unable to read the input files")
+	ErrInputUnparseable = errors.New("the input files are unparseable")
+
+	// Errors of the sensor-reading functions, which wrap them along with
+	// more detail, and any underlying cause; check for them with errors.Is.
+	ErrInvalidInput  = errors.New("invalid input")
+	ErrNoSensors     = errors.New("no valid sensors")
+	ErrHwmonNotFound = errors.New("hwmon directory not found")
+
+	// number of times a sensor file read is attempted, when it fails with a
+	// transient error such as EBUSY; e.g. just after resuming from suspend
+	ReadAttempts = 3
+
+	// delay before the first retry of a read, doubling on each later retry
+	ReadRetryDelay = 10 * time.Millisecond
+
+	// Receives debug messages, if set; e.g. to print them.
+	DebugFunc func(string)
+
+	// Fan control modes, as per the pwmN_enable files; anything above
+	// these is one of the automatic modes of the driver.
+	pwmModes = map[int]string{
+		0: "full speed",
+		1: "manual",
+	}
+
+	// Attribute files for storing the limits of each sensor category.
+	categoryLimitSuffixes = map[string][]string{
+		"temp": {MinSuffix, MaxSuffix, CritSuffix},
+		"fan":  {"_min", "_target"},
+	}
+
+	// Unit of each sensor category, once scaled.
+	categoryUnits = map[string]string{
+		"temp":     "C",
+		"in":       "V",
+		"fan":      "RPM",
+		"curr":     "A",
+		"power":    "W",
+		"energy":   "J",
+		"humidity": "%RH",
+	}
+
+	// Decimal places of the values of categories that are commonly smaller
+	// than a single unit, or where whole units lose too much precision, e.g.
+	// the watts of a CPU package; other categories are whole numbers.
+	categoryPrecisions = map[string]int{
+		"in":    3,
+		"curr":  3,
+		"power": 1,
+	}
+
+	// Fixed-point scale of each hwmon sensor category, as documented in the
+	// kernel hwmon sysfs ABI (Documentation/hwmon/sysfs-interface.rst);
+	// dividing the raw value by this gives the value in human units.
+	categoryDivisors = map[string]int{
+		"temp":     1000,    // millidegrees Celsius
+		"in":       1000,    // millivolts
+		"fan":      1,       // revolutions per minute
+		"curr":     1000,    // milliamperes
+		"power":    1000000, // microwatts
+		"energy":   1000000, // microjoules
+		"humidity": 1000,    // milli-percent relative humidity
+	}
+)
@@ -1,22 +1,49 @@
 package main
 
-type Sensor struct {
+import "github.com/rbisewski/tempchk/pkg/tempchk"
 
-        // name of sensor
-        name string
+type Device struct {
 
-        // location to the OS path
-        path string
+	// hwmon directory of the device; e.g. hwmon0
+	hwmon string
 
-        // sensor type; e.g. temp for Temperature sensors or fan for Fan sensors
-        category string
+	// identifier of the device that is stable across reboots, as shown
+	// by -stable-names; e.g. 0000:00:18.3
+	stableName string
 
-        // refined sensor data, as an int
-        intData int
+	// name of the device, as per its hardware name file
+	name string
 
-        // current sensor number, for a given category, for a given hwmon; e.g. temp sensor 3 of a device with 5 temp sensors
-        number int
+	// sensors of the device, with their values already scaled and corrected
+	sensors []tempchk.Sensor
 
-        // maximum number of sensors, for a given category, for a given hwmon
-        count int
+	// why the device has no sensors, if it has none
+	err error
+}
+
+// Sensors read from a single device, by its position in the scan.
+type deviceSensors struct {
+
+	// index of the device, in the order the devices are printed
+	index int
+
+	// unscaled sensors read from the device
+	sensors []tempchk.Sensor
+
+	// why the device has no sensors, if it has none
+	err error
+}
+
+// Marshalable result of a threshold check, as printed by -json when
+// -threshold is given.
+type jsonStatus struct {
+
+	// ok if no sensor reached its threshold, else hot
+	Status string `json:"status"`
+
+	// every sensor of the scan
+	Sensors []tempchk.Sensor `json:"sensors"`
+
+	// sensors at or above their threshold, if any
+	Tripped []tempchk.Sensor `json:"tripped"`
 }
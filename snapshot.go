@@ -0,0 +1,128 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rbisewski/tempchk/pkg/tempchk"
+)
+
+// directory every file of a snapshot is stored under, so that it extracts
+// into a tree that -hwmon-dir can read, e.g. -hwmon-dir hwmon/
+var snapshotDirectory = "hwmon/"
+
+//! Adds a single file to a snapshot tarball.
+/*
+ * @param      tar.Writer    tarball being written
+ * @param      string        path of the file within the tarball
+ * @param      string        contents of the file
+ * @param      time.Time     time the snapshot was taken
+ *
+ * @returns    error         error message, if any
+ */
+func writeSnapshotFile(tw *tar.Writer, name string, contents string,
+	now time.Time) error {
+
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(contents)),
+		ModTime: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write([]byte(contents))
+	return err
+}
+
+//! Captures the attribute files of every hwmon device into a tarball.
+/*
+ * Sysfs files report a size that has nothing to do with their contents,
+ * so each attribute is read and stored as a plain file; symlinks, e.g.
+ * that of device, are not kept, so -stable-names cannot be used with an
+ * extracted snapshot.
+ *
+ * @param      string    path of the gzipped tarball to write
+ *
+ * @returns    error     error message, if any
+ */
+func saveSnapshot(path string) error {
+
+	entries, err := tempchk.DefaultFileSystem.ReadDir(
+		tempchk.HardwareMonitorDirectory)
+	if err != nil {
+		return fmt.Errorf("saveSnapshot(): unable to read %s",
+			tempchk.HardwareMonitorDirectory)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("saveSnapshot(): unable to create %s", path)
+	}
+
+	// This only covers the early returns; the file is closed again once
+	// written, checking the error, since a full disk may only show up then.
+	defer file.Close()
+
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+	now := time.Now()
+	count := 0
+
+	for _, entry := range entries {
+
+		hwmon := entry.Name()
+		if !hwmonEntryResolves(hwmon) {
+			continue
+		}
+
+		files, err := tempchk.DefaultFileSystem.ReadDir(
+			tempchk.HardwareMonitorDirectory + hwmon)
+		if err != nil {
+			debug("Warning: unable to list " + hwmon + ", so it is left " +
+				"out of the snapshot")
+			continue
+		}
+
+		for _, f := range files {
+
+			// Only the name file is of use from the subdirectories, as
+			// some drivers keep it in e.g. device/name.
+			attribute := f.Name()
+			if f.IsDir() || f.Mode()&os.ModeSymlink != 0 {
+				attribute += "/" + tempchk.HardwareNameFile
+			}
+
+			// Write-only attributes, e.g. temp1_reset_history, cannot be
+			// read, so are simply left out.
+			value, err := tempchk.ReadAttribute(hwmon, attribute)
+			if err != nil {
+				continue
+			}
+
+			err = writeSnapshotFile(tw, snapshotDirectory+hwmon+"/"+
+				attribute, value+"\n", now)
+			if err != nil {
+				return fmt.Errorf("saveSnapshot(): unable to write %s", path)
+			}
+		}
+
+		count++
+	}
+
+	if tw.Close() != nil || gw.Close() != nil || file.Close() != nil {
+		return fmt.Errorf("saveSnapshot(): unable to write %s", path)
+	}
+
+	fmt.Println("tempchk: saved a snapshot of " + strconv.Itoa(count) +
+		" devices to " + path + "; extract it and read it back with " +
+		"-hwmon-dir " + snapshotDirectory)
+
+	return nil
+}
@@ -1,203 +1,1743 @@
 package main
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"log"
 	"os"
-	"strings"
+	"os/signal"
+	"path"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rbisewski/tempchk/pkg/tempchk"
 )
 
-//
 // Globals
-//
 var (
-	// cpu info location, as of kernel 4.4+
-	cpuinfoDirectory = "/proc/cpuinfo"
-
-	// Current location of the hardware sensor data, as of kernel 4.4+
-	hardwareMonitorDirectory = "/sys/class/hwmon/"
-
 	// Whether or not to print debug messages.
 	debugMode = false
 
-	// Attribute file for storing the hardware device name.
-	hardwareNameFile = "name"
+	// destination of the debug messages, each prefixed with a timestamp
+	debugLogger = log.New(os.Stderr, "tempchk: ", log.LstdFlags)
+
+	// hwmon directory given by the -hwmon-dir flag, if any
+	hwmonDirectoryOverride = ""
+
+	// environment variable that may also override the hwmon directory
+	hwmonDirectoryEnv = "TEMPCHK_HWMON_DIR"
+
+	// Sensor categories read from every device, in the order they are shown.
+	sensorCategories = []string{tempchk.TempPrefix, tempchk.FanPrefix}
+
+	// Sensor categories also read when the -all flag is given.
+	extraSensorCategories = []string{tempchk.VoltagePrefix,
+		tempchk.CurrentPrefix, tempchk.PowerPrefix}
+
+	// whether or not to read the extra sensor categories too
+	readAllCategories = false
+
+	// Description of each sensor category, for sensors without a label.
+	categoryDescriptions = map[string]string{
+		"temp":  "temperature sensor",
+		"fan":   "fan sensor",
+		"in":    "voltage sensor",
+		"curr":  "current sensor",
+		"power": "power sensor",
+	}
+
+	// Attribute files describing a single sensor, as shown by -all-attributes.
+	sensorAttributeSuffixes = []string{"_input", "_max", "_crit",
+		"_crit_hyst", "_label", "_alarm", "_fault", "_offset"}
+
+	// file of per-chip divisors that replace the category defaults
+	scaleOverridePath = ""
+
+	// divisors from the scale override file, keyed by chip:category
+	scaleOverrides = map[string]int{}
+
+	// Unit text of each sensor category, per unit style.
+	unitStyles = map[string]map[string]string{
+		"standard": {
+			"temp":     "C",
+			"in":       "V",
+			"fan":      "RPM",
+			"curr":     "A",
+			"power":    "W",
+			"energy":   "J",
+			"humidity": "%RH",
+		},
+		"compact": {
+			"temp":     "C",
+			"in":       "V",
+			"fan":      "r",
+			"curr":     "A",
+			"power":    "W",
+			"energy":   "J",
+			"humidity": "%",
+		},
+		"long": {
+			"temp":     "Celsius",
+			"in":       "volts",
+			"fan":      "revolutions per minute",
+			"curr":     "amperes",
+			"power":    "watts",
+			"energy":   "joules",
+			"humidity": "percent relative humidity",
+		},
+	}
+
+	// file to save the currently present sensors to, as a baseline
+	saveBaselinePath = ""
+
+	// file of a previously saved baseline of sensors
+	baselinePath = ""
+
+	// gzipped tarball to capture the hwmon directory into, for offline use
+	snapshotPath = ""
+
+	// values of the baseline, keyed by sensor identity; nil without one
+	baselineValues map[string]int
+
+	// whether or not to only report missing, faulted or alarmed sensors
+	faultsOnly = false
+
+	// whether or not to lowercase device names for matching and display
+	normalizeNames = false
+
+	// whether or not to print the raw, unscaled value of each sensor
+	showRawValues = false
+
+	// whether or not to dump every attribute file of each sensor
+	showAllAttributes = false
+
+	// maximum duration of a single scan pass; 0 means no limit
+	scanDeadline = time.Duration(0)
+
+	// longest a single sensor file read may take; 0 means no limit
+	readTimeout = 5 * time.Second
+
+	// number of times a sensor file read is attempted on transient errors
+	readAttempts = 3
+
+	// exit code used when the scan deadline is exceeded
+	deadlineExitCode = 3
+
+	// error returned by a scan that exceeded its deadline
+	errScanDeadline = errors.New("ScanDevices(): scan deadline exceeded")
+
+	// reason of a device that only has sensors of categories not being read,
+	// e.g. voltages without -all
+	errOtherCategories = errors.New("only sensors of other categories, " +
+		"try -all")
+
+	// exit codes used when the sensors are in a warning or critical state
+	warnExitCode = 1
+	critExitCode = 2
 
-	// Attribute file for storing the hardware device current temperature.
-        tempPrefix = "temp"
-        inputSuffix = "_input"
+	// file of per-sensor thresholds and labels
+	configPath = ""
+
+	// settings from the config file, keyed by sensor identity
+	sensorConfigs = map[string]sensorConfig{}
+
+	// temperature, in degrees Celsius, at or above which to exit with the
+	// warning exit code; 0 means no threshold
+	thresholdTemperature = 0
+
+	// whether or not to only print the sensors at or above their threshold
+	quietMode = false
+
+	// comma-separated names of the devices that must be present; e.g.
+	// k10temp,nvme
+	requiredDevices = ""
+
+	// whether or not to skip the temperature corrections entirely
+	noCorrections = false
+
+	// degrees added to k10temp readings when the AMD digital power module
+	// is not in use
+	k10tempOffset = 30
+
+	// number of samples to average per sensor
+	sampleCount = 1
+
+	// delay between each of the samples of a sensor
+	sampleDelay = 100 * time.Millisecond
+
+	// whether or not to print the min, max and average temperature
+	showSummary = false
+
+	// whether or not to show how close each temperature is to its max
+	showHeadroom = false
+
+	// whether or not to show the minimum and target speeds of fans
+	showFanLimits = false
+
+	// whether or not to show the PWM duty and control mode of fan sensors
+	showFanPWM = false
+
+	// whether or not to only list the devices, without reading them
+	listDevicesOnly = false
+
+	// whether or not to print each device once, with its sensors beneath it
+	groupByDevice = false
+
+	// whether or not to drop temperatures outside the plausible range
+	strictMode = false
+
+	// whether or not to read the thermal zones too, and not only when
+	// there are no hwmon devices
+	readThermalZones = false
+
+	// whether or not to print the sensors as a JSON array
+	jsonOutput = false
+
+	// order to print the sensors in; device, name or temp
+	sortOrder = "device"
+
+	// file to write the printed sensors to, instead of stdout
+	outputPath = ""
+
+	// whether or not to append to the output file, rather than truncate it
+	appendOutput = false
+
+	// destination of the printed sensors; stdout, unless -output is given
+	outputWriter io.Writer = os.Stdout
+
+	// whether or not to print the sensors as CSV rows
+	csvOutput = false
+
+	// header row of the CSV output, before any timestamp column
+	csvHeader = []string{"device", "chip", "sensor_label", "category",
+		"number", "value", "unit"}
+
+	// unit to print temperatures in; C, F or K
+	temperatureUnit = "C"
+
+	// spelled-out names of the temperature units, for the long unit style
+	temperatureUnitNames = map[string]string{
+		"C": "Celsius",
+		"F": "Fahrenheit",
+		"K": "Kelvin",
+	}
+
+	// style of the unit text to print
+	unitStyle = "standard"
 
 	// flag to check whether the AMD digital thermo module is in use
 	digitalAmdPowerModuleInUse = false
 
-	// size of the longest hwmonX/name entry string
-	maxEntryLength = 0
+	// guards the globals set by SetGlobalSensorFlags, since scans may run
+	// concurrently
+	sensorFlagsMutex sync.Mutex
+
+	// names of the hwmon devices, reused by every later scan
+	deviceNames = newDeviceNameCache()
 
-	// spacer size
+	// values printed by the previous watch iteration, to show the trend of
+	// each temperature against; nil if there is none
+	trendValues map[string]int = nil
+
+	// largest change of a temperature, either way, that still counts as
+	// steady, so that noise does not make the trend flicker
+	trendDeadband = 1
+
+	// spacer size, between each of the printed columns
 	spacerSize = 4
 
+	// decimals to print temperatures to; 0 keeps them whole
+	roundDecimals = 0
+
 	// Whether or not to print the current version of the program
 	printVersion = false
 
 	// default version value
 	Version = "0.0"
+
+	// git commit and date of the build, as set via -ldflags
+	Commit    = ""
+	BuildDate = ""
+
+	// maximum number of symlinks to follow when resolving a hwmon entry
+	followSymlinkDepth = 8
+
+	// whether or not to identify devices by their stable device names
+	stableNames = false
+
+	// only show sensors belonging to the device with this name
+	deviceFilter = ""
+
+	// comma-separated list of device name globs to read; blank means all
+	deviceNameFilter = ""
+
+	// only show sensors with this number, across devices; -1 means all,
+	// since voltage sensors start at in0
+	numberFilter = -1
+
+	// category of the sensors selected by -number, e.g. fan for fan1
+	numberCategory = "temp"
+
+	// only show sensors whose label starts with this prefix
+	labelFilter = ""
+
+	// comma-separated device:sensor specifiers of sensors to leave out
+	ignoreList = ""
+
+	// sensors to leave out, keyed by lowercase device:sensor specifier;
+	// e.g. nct6799:temp7 or k10temp:tctl
+	ignoredSensors = make(map[string]bool)
+
+	// whether or not to print only the value of a single matching sensor
+	valueOnly = false
+
+	// whether or not to collapse sensors that appear to be aliases
+	mergeDuplicateSensors = false
+
+	// whether or not to keep running, redrawing only when a value changes
+	refreshOnChange = false
+
+	// how often to poll the sensors when refreshing on change
+	refreshPollInterval = 250 * time.Millisecond
+
+	// address to serve Prometheus metrics on, e.g. :9101; blank means none
+	listenAddress = ""
+
+	// how far back -listen averages the sensors over, as *_avg gauges; 0
+	// means no averages
+	averageWindow = time.Duration(0)
+
+	// delay between each of the samples that are averaged
+	averageSampleInterval = time.Second
+
+	// address to serve the sensors as JSON on, e.g. :8080; blank means none
+	serveAddress = ""
+
+	// whether or not to run the interactive terminal UI
+	tuiMode = false
+
+	// how often to refresh the readings in watch mode; 0 means run once
+	watchInterval = time.Duration(0)
+
+	// how often to refresh the readings in the TUI, unless told otherwise
+	defaultRefreshInterval = 2 * time.Second
+
+	// when to color the printed values; auto, always or never
+	colorMode = "auto"
+
+	// escape sequences wrapping values that have no color band, which are
+	// the same length as those of the bands so the columns stay aligned
+	uncoloredPrefix = "\033[39m"
+	colorSuffix     = "\033[0m"
+
+	// temperatures at which sensors are considered warm and hot
+	warmTemperature = 60
+	hotTemperature  = 80
+
+	// degrees between absolute zero and 0 C
+	kelvinOffset = 273.15
 )
 
 // Initialize the argument input flags.
 func init() {
 
+	// Print the debug messages of the sensor-reading package too.
+	tempchk.DebugFunc = debug
+
 	flag.BoolVar(&printVersion, "version", false,
 		"Print the current version of this program and exit.")
 
 	flag.BoolVar(&debugMode, "debug", false,
-		"Dump debug output to stdout.")
+		"Dump debug output to stderr.")
+
+	flag.StringVar(&hwmonDirectoryOverride, "hwmon-dir", "",
+		"Read the sensors from the given directory instead of "+
+			"/sys/class/hwmon/; also settable via "+hwmonDirectoryEnv+".")
+
+	flag.IntVar(&followSymlinkDepth, "follow-symlink-depth", 8,
+		"Maximum number of symlinks to follow when resolving a hwmon entry.")
+
+	flag.BoolVar(&stableNames, "stable-names", false,
+		"Identify devices by their bus identifier, e.g. 0000:00:18.3, "+
+			"rather than hwmonN, which may change across reboots.")
+
+	flag.StringVar(&deviceFilter, "device", "",
+		"Only show sensors of the device with the given name, e.g. coretemp.")
+
+	flag.StringVar(&deviceNameFilter, "filter", "",
+		"Only read devices whose name matches one of the given comma-"+
+			"separated globs, e.g. k10temp,nvme*; case-insensitive.")
+
+	flag.IntVar(&numberFilter, "number", -1,
+		"Only show the sensor with the given number, of the category given "+
+			"by -number-category; e.g. 1 for temp1.")
+
+	flag.StringVar(&numberCategory, "number-category", "temp",
+		"Category of the sensor selected by -number: temp, fan, in, curr or "+
+			"power; e.g. fan with -number 1 for fan1.")
+
+	flag.StringVar(&labelFilter, "label", "",
+		"Only show sensors whose label starts with the given prefix, e.g. AUXTIN*.")
+
+	flag.StringVar(&ignoreList, "ignore", "",
+		"Comma-separated device:sensor specifiers of sensors to leave out "+
+			"entirely, by number or label; e.g. nct6799:temp7,k10temp:Tccd1.")
+
+	flag.BoolVar(&valueOnly, "value-only", false,
+		"Print only the value of the single sensor matching the filters.")
+
+	flag.BoolVar(&mergeDuplicateSensors, "merge-duplicate-sensors", false,
+		"Collapse sensors of a device that report identical readings.")
+
+	flag.BoolVar(&refreshOnChange, "refresh-on-change", false,
+		"Keep running, redrawing the output only when a reading changes.")
+
+	flag.DurationVar(&watchInterval, "watch", 0,
+		"Re-read and re-print the sensors at the given interval, e.g. 2s.")
+
+	flag.StringVar(&listenAddress, "listen", "",
+		"Serve Prometheus metrics at /metrics on the given address, e.g. :9101.")
+
+	flag.DurationVar(&averageWindow, "average-window", 0,
+		"Also serve the average of each gauge over the given window, e.g. "+
+			"1m, as sampled every second; requires -listen.")
+
+	flag.StringVar(&serveAddress, "serve", "",
+		"Serve the sensors as JSON at /sensors on the given address, e.g. :8080.")
+
+	flag.BoolVar(&tuiMode, "tui", false,
+		"Show a live-updating table of sensors; q quits, s changes the sort.")
+
+	flag.StringVar(&saveBaselinePath, "save-baseline", "",
+		"Save the currently present sensors to the given baseline file.")
+
+	flag.StringVar(&snapshotPath, "snapshot", "",
+		"Capture the hwmon directory into the given gzipped tarball, e.g. "+
+			"to attach to a bug report; extract it and read it back with "+
+			"-hwmon-dir hwmon/.")
+
+	flag.StringVar(&baselinePath, "baseline", "",
+		"Compare against the sensors of the given baseline file, or -json "+
+			"output, showing how far each has moved and exiting non-zero "+
+			"if any have since disappeared.")
+
+	flag.BoolVar(&faultsOnly, "faults", false,
+		"Only report sensors that are missing, faulted or in alarm.")
+
+	flag.BoolVar(&normalizeNames, "normalize-names", false,
+		"Lowercase and trim device names, so -device matches across kernels.")
+
+	flag.StringVar(&scaleOverridePath, "scale-override", "",
+		"File of chip:category=divisor lines overriding the default scales.")
+
+	flag.BoolVar(&showRawValues, "show-raw-millidegrees", false,
+		"Also print the raw value read from each sensor's input file.")
+
+	flag.BoolVar(&showAllAttributes, "all-attributes", false,
+		"Dump every attribute file of each temperature sensor.")
+
+	flag.BoolVar(&readThermalZones, "thermal-zones", false,
+		"Also read the temperatures of the thermal zones in "+
+			tempchk.ThermalZoneDirectory+"; done anyway if there are no "+
+			"hwmon devices.")
+
+	flag.BoolVar(&strictMode, "strict", false,
+		"Drop temperatures outside the plausible range, rather than "+
+			"marking them with a ?.")
+
+	flag.BoolVar(&groupByDevice, "group", false,
+		"Print each device once as a header, with its sensors indented "+
+			"beneath it.")
+
+	flag.BoolVar(&listDevicesOnly, "list", false,
+		"List each device and how many temp and fan sensors it has, "+
+			"without reading them, and exit.")
+
+	flag.DurationVar(&scanDeadline, "deadline", 0,
+		"Maximum duration of a scan, e.g. 500ms; partial results exit with "+
+			"code 3.")
+
+	flag.DurationVar(&readTimeout, "timeout", 5*time.Second,
+		"Maximum duration of a single sensor file read, e.g. 2s; sensors "+
+			"that take longer are skipped.")
+
+	flag.IntVar(&readAttempts, "read-attempts", 3,
+		"Number of times to attempt a sensor file read that fails with a "+
+			"transient error, e.g. EBUSY after resuming from suspend.")
+
+	flag.IntVar(&warnExitCode, "warn-exit-code", 1,
+		"Exit code used when a sensor is in a warning state, e.g. in alarm.")
+
+	flag.IntVar(&critExitCode, "crit-exit-code", 2,
+		"Exit code used when a sensor is in a critical state, e.g. faulted.")
+
+	flag.StringVar(&configPath, "config", "",
+		"TOML file of per-sensor thresholds and labels, as tables of e.g. "+
+			"[k10temp.temp1] with threshold = 85 and label = \"CPU die\".")
+
+	flag.IntVar(&thresholdTemperature, "threshold", 0,
+		"Exit with the warning exit code if any temperature is at or above "+
+			"the given degrees Celsius.")
+
+	flag.StringVar(&requiredDevices, "require", "",
+		"Comma-separated names of devices that must be present, e.g. "+
+			"k10temp,nvme; exits with the critical exit code if any are "+
+			"missing.")
+
+	flag.BoolVar(&quietMode, "quiet", false,
+		"Only print the sensors at or above their threshold, and nothing "+
+			"at all if there are none; requires -threshold or -config.")
+
+	flag.BoolVar(&noCorrections, "no-corrections", false,
+		"Print temperatures as the drivers report them, without any of the "+
+			"per-driver corrections, e.g. that of k10temp.")
+
+	flag.IntVar(&k10tempOffset, "k10temp-offset", 30,
+		"Degrees added to k10temp readings when the AMD digital power "+
+			"module is not in use; 0 disables the correction.")
+
+	flag.BoolVar(&readAllCategories, "all", false,
+		"Also read voltage, current and power sensors, in V, A and W.")
+
+	flag.IntVar(&spacerSize, "spacer", 4,
+		"Number of spaces between each of the printed columns.")
+
+	flag.IntVar(&roundDecimals, "round", 0,
+		"Number of decimals to print temperatures to, from 0 to 3; -json "+
+			"values are whole degrees regardless.")
+
+	flag.IntVar(&sampleCount, "count", 1,
+		"Number of samples to take of each sensor, printing their average.")
+
+	flag.BoolVar(&showSummary, "summary", false,
+		"Print the coolest, hottest and average temperature after the sensors.")
+
+	flag.BoolVar(&showHeadroom, "headroom", false,
+		"Show each temperature as a percentage of its max, if known.")
+
+	flag.BoolVar(&showFanLimits, "show-fan-limits", false,
+		"Show the minimum and target speeds of fan sensors.")
+
+	flag.BoolVar(&showFanPWM, "fans", false,
+		"Show the PWM duty, as a percentage, and whether fans are under "+
+			"automatic or manual control; fans without PWM files show neither.")
+
+	flag.BoolVar(&jsonOutput, "json", false,
+		"Print the sensors as a JSON array; with -threshold, as an object "+
+			"that also gives the status and the sensors that tripped it.")
+
+	flag.BoolVar(&csvOutput, "csv", false,
+		"Print the sensors as CSV rows; with -watch, rows are appended "+
+			"with a timestamp column.")
+
+	flag.StringVar(&sortOrder, "sort", "device",
+		"Order of the printed sensors: device, name or temp (hottest first).")
+
+	flag.StringVar(&colorMode, "color", "auto",
+		"Color temperatures by how hot they are: auto, always or never.")
+
+	flag.StringVar(&outputPath, "output", "",
+		"Write the printed sensors to the given file, instead of stdout.")
+
+	flag.BoolVar(&appendOutput, "append", false,
+		"Append to the -output file, rather than truncating it.")
+
+	flag.StringVar(&temperatureUnit, "unit", "C",
+		"Unit to print temperatures in: C, F or K.")
+
+	flag.StringVar(&unitStyle, "unit-style", "standard",
+		"Style of the printed units: standard, compact or long.")
 }
 
-//
 // PROGRAM MAIN
-//
 func main() {
 
 	flag.Parse()
 
 	if printVersion {
-		fmt.Println("tempchk v" + Version)
+
+		// A plain go build leaves out the build metadata.
+		if Commit == "" {
+			Commit = "unknown"
+		}
+		if BuildDate == "" {
+			BuildDate = "unknown"
+		}
+
+		fmt.Println("tempchk v" + Version + " (commit " + Commit +
+			", built " + BuildDate + ")")
 		os.Exit(0)
 	}
 
-        // normally there will likely be at least one sensor exposed to
-        // the operating system; however, in theory there could be edge cases
-        // where there are no sensors, so account for that here
-	listOfDeviceDirs, err := ioutil.ReadDir(hardwareMonitorDirectory)
-	if err != nil {
-		panic(err)
+	// The flag takes precedence over the environment, which in turn
+	// takes precedence over the default location.
+	directory := os.Getenv(hwmonDirectoryEnv)
+	if hwmonDirectoryOverride != "" {
+		directory = hwmonDirectoryOverride
+	}
+	if directory != "" {
+		if !strings.HasSuffix(directory, "/") {
+			directory += "/"
+		}
+		tempchk.HardwareMonitorDirectory = directory
 	}
 
-	// Debug mode, print out a list of files in the directory specified by
-	// the "hardwareMonitorDirectory" global variable.
-	if debugMode {
+	if readAllCategories {
+		sensorCategories = append(sensorCategories, extraSensorCategories...)
+	}
 
-		debug("The following IDs are present in the hardware sensor " +
-			"monitoring directory:\n")
+	// Outside of Linux there is no hwmon directory at all, so say so
+	// rather than failing on every read; some containers only have the
+	// thermal zones though, which are then read instead.
+	if !sensorsAvailable() {
+		fmt.Fprintln(os.Stderr, "tempchk: hwmon directory not found, are "+
+			"you running on Linux?")
+		os.Exit(1)
+	}
 
-		for _, dir := range listOfDeviceDirs {
-			debug("* " + dir.Name())
-		}
+	if _, ok := unitStyles[unitStyle]; !ok {
+		fmt.Fprintln(os.Stderr, "tempchk: unknown -unit-style "+unitStyle+
+			", expected standard, compact or long")
+		os.Exit(1)
 	}
 
-	// Search thru the directories and set the relevant flags...
-	err = SetGlobalSensorFlags(listOfDeviceDirs)
+	if _, ok := temperatureUnitNames[temperatureUnit]; !ok {
+		fmt.Fprintln(os.Stderr, "tempchk: unknown -unit "+temperatureUnit+
+			", expected C, F or K")
+		os.Exit(1)
+	}
 
-	// safety check, ensure no errors occurred
-	if err != nil {
-		fmt.Println(err)
+	if colorMode != "auto" && colorMode != "always" && colorMode != "never" {
+		fmt.Fprintln(os.Stderr, "tempchk: unknown -color "+colorMode+
+			", expected auto, always or never")
 		os.Exit(1)
 	}
 
-	// For each of the devices...
-	for _, dir := range listOfDeviceDirs {
+	if readAttempts < 1 {
+		fmt.Fprintln(os.Stderr, "tempchk: -read-attempts must be at least 1")
+		os.Exit(1)
+	}
 
-		// Assemble the filepath to the name file of the currently given
-		// hardware device.
-		hardwareNameFilepathOfGivenDevice := hardwareMonitorDirectory +
-			dir.Name() + "/" + hardwareNameFile
+	tempchk.ReadTimeout = readTimeout
+	tempchk.ReadAttempts = readAttempts
 
-		// If debug mode, print out the current 'name' file we are about
-		// to open.
-		debug(dir.Name() + " --> " +
-			hardwareNameFilepathOfGivenDevice)
+	if appendOutput && outputPath == "" {
+		fmt.Fprintln(os.Stderr, "tempchk: -append requires -output")
+		os.Exit(1)
+	}
 
-		// ...check to see if a 'name' file is present inside the directory.
-		nameValueOfHardwareDevice, err := ioutil.ReadFile(
-			hardwareNameFilepathOfGivenDevice)
+	if outputPath != "" {
+
+		mode := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if appendOutput {
+			mode = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
 
-		// If err is not nil, skip this device.
+		file, err := os.OpenFile(outputPath, mode, 0644)
 		if err != nil {
+			fmt.Fprintln(os.Stderr, "tempchk: unable to open -output file "+
+				outputPath+": "+err.Error())
+			os.Exit(1)
+		}
+
+		// Writes go straight to the file, so it needs no flushing on exit.
+		outputWriter = file
+	}
+
+	if sampleCount < 1 {
+		fmt.Fprintln(os.Stderr, "tempchk: -count must be at least 1")
+		os.Exit(1)
+	}
 
-			// If debug mode, then print out a message telling the user
-			// which device is missing a hardware 'name' file.
-			debug("Warning: " + dir.Name() + " does not contain a " +
-				"hardware name file. Skipping...")
+	for _, specifier := range strings.Split(ignoreList, ",") {
 
-			// Move on to the next device.
+		specifier = strings.TrimSpace(specifier)
+		if specifier == "" {
 			continue
 		}
 
-		// If the hardware name file does not contain anything of value,
-		// skip it and move on to the next device.
-		if len(nameValueOfHardwareDevice) < 1 {
+		device, sensor, ok := splitIgnoreSpecifier(specifier)
+		if !ok {
+			fmt.Fprintln(os.Stderr, "tempchk: -ignore expects device:sensor "+
+				"specifiers, e.g. nct6799:temp7, but got "+specifier)
+			os.Exit(1)
+		}
+
+		ignoredSensors[strings.ToLower(normalizeName(device)+":"+sensor)] =
+			true
+	}
 
-			// If debug mode, then print out a message telling the user
-			// which device is missing a hardware 'name' file.
-			debug("Warning: The hardware name file of " + dir.Name() +
-				" does not contain valid data. Skipping...")
+	if _, ok := categoryDescriptions[numberCategory]; !ok {
+		fmt.Fprintln(os.Stderr, "tempchk: -number-category must be one of "+
+			"temp, fan, in, curr or power")
+		os.Exit(1)
+	}
 
-			// Move on to the next device.
-			continue
+	if spacerSize < 1 {
+		fmt.Fprintln(os.Stderr, "tempchk: -spacer must be at least 1")
+		os.Exit(1)
+	}
+
+	// hwmon only reports millidegrees, so more decimals would be made up
+	if roundDecimals < 0 || roundDecimals > 3 {
+		fmt.Fprintln(os.Stderr, "tempchk: -round must be between 0 and 3")
+		os.Exit(1)
+	}
+
+	// A lone value has no place in a JSON or CSV document.
+	if valueOnly && (jsonOutput || csvOutput) {
+		fmt.Fprintln(os.Stderr, "tempchk: -value-only cannot be used with "+
+			"-json or -csv")
+		os.Exit(1)
+	}
+
+	// The table is redrawn in place, so refuse the formats that the watch
+	// modes cannot honour; only CSV rows can be appended at each interval.
+	if refreshOnChange && (jsonOutput || csvOutput) {
+		fmt.Fprintln(os.Stderr, "tempchk: -refresh-on-change cannot be "+
+			"used with -json or -csv")
+		os.Exit(1)
+	}
+	if watchInterval > 0 && jsonOutput {
+		fmt.Fprintln(os.Stderr, "tempchk: -watch cannot be used with -json")
+		os.Exit(1)
+	}
+
+	if sortOrder != "device" && sortOrder != "name" && sortOrder != "temp" {
+		fmt.Fprintln(os.Stderr, "tempchk: unknown -sort "+sortOrder+
+			", expected device, name or temp")
+		os.Exit(1)
+	}
+
+	// Reject malformed globs up front, rather than silently matching nothing.
+	for _, pattern := range strings.Split(deviceNameFilter, ",") {
+		if _, err := path.Match(pattern, ""); err != nil {
+			fmt.Fprintln(os.Stderr, "tempchk: malformed -filter pattern "+
+				pattern)
+			os.Exit(1)
+		}
+	}
+
+	if configPath != "" {
+		configs, err := loadConfigFile(configPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
+		sensorConfigs = configs
+	}
 
-		// Trim away any excess whitespace from the hardware name file data.
-		trimmedName := strings.Trim(string(nameValueOfHardwareDevice), " \n")
+	// Without any thresholds, quiet mode would never print anything.
+	if quietMode && thresholdTemperature == 0 && len(sensorConfigs) == 0 {
+		fmt.Fprintln(os.Stderr, "tempchk: -quiet requires -threshold or a "+
+			"-config file of thresholds")
+		os.Exit(1)
+	}
 
-                sensors, err := GetSensorData(trimmedName, dir.Name())
+	if scaleOverridePath != "" {
+		overrides, err := loadScaleOverrides(scaleOverridePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		scaleOverrides = overrides
+	}
 
-		// If err is not nil, then the temperature file does not have valid
-		// integer data. So tell the end-user no data is available.
-		if err != nil || len(sensors) < 1 {
+	if snapshotPath != "" {
+		err := saveSnapshot(snapshotPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-			debug("Warning: " + dir.Name() + " does not contain " +
-				"valid sensor data in the hardware input file, " +
-				"ergo no temperature data to print for this device.")
+	if saveBaselinePath != "" {
+		err := saveBaselineFile(saveBaselinePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-			// append string values equivalent to the longest length.
-                        paddedName := trimmedName
-			for len(paddedName) < maxEntryLength+spacerSize {
-				paddedName += " "
-			}
+	if baselinePath != "" {
+		baseline, err := loadBaselineFile(baselinePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		baselineValues = baseline
+	}
 
-			// Finally, print out the temperature data of the current device.
-			fmt.Println(dir.Name(), "  ", paddedName, "N/A")
+	if faultsOnly {
+		os.Exit(reportFaults(outputWriter))
+	}
 
-			// With that done, go ahead and move on to the next device.
-			continue
+	if showAllAttributes {
+		err := printAllAttributes(outputWriter)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if listDevicesOnly {
+		err := printDeviceList(outputWriter)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if averageWindow > 0 && listenAddress == "" {
+		fmt.Fprintln(os.Stderr, "tempchk: -average-window requires -listen")
+		os.Exit(1)
+	}
+
+	if listenAddress != "" {
+
+		// The gauges are named for their units, so keep to those.
+		if temperatureUnit != "C" {
+			fmt.Fprintln(os.Stderr, "tempchk: -listen reports temperatures "+
+				"in Celsius, so -unit cannot be used with it")
+			os.Exit(1)
+		}
+
+		err := serveMetrics(listenAddress)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
+		return
+	}
 
-                for _, sensor := range sensors {
+	if serveAddress != "" {
+		err := serveSensors(serveAddress)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-                        // Usually hardware sensors uses 3-sigma of precision and stores
-                        // the value as an integer for purposes of simplicity.
-                        //
-                        // Ergo, this needs to be divided by 1000 to give temperature
-                        // values that are meaningful to humans.
-                        //
-                        sensor.intData /= 1000
+	if tuiMode {
+		err := runTui()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-                        // This acts as a work-around for the k10temp sensor module.
-                        if sensor.name == "k10temp" &&
-				!digitalAmdPowerModuleInUse {
+	if refreshOnChange {
+		watchForChanges()
+		return
+	}
 
-				// Add 30 degrees to the current temperature.
-				sensor.intData += 30
-                        }
+	if watchInterval > 0 {
+		watchSensors()
+		return
+	}
 
-                        // append string values equivalent to the longest length.
-                        paddedName := sensor.name
-                        for len(paddedName) < maxEntryLength+spacerSize {
-				paddedName += " "
-                        }
+	// A single run already scans afresh, so there is nothing to rescan.
+	signal.Ignore(syscall.SIGHUP)
 
-                        sensorLabel := ""
-                        if sensor.category == "temp" {
-                                sensorLabel = "C"
-                        }
+	devices, complete, err := collectDevices()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-                        if sensor.category == "temp" {
-                                sensorLabel += "   temperature sensor " + strconv.Itoa(sensor.number)
-                        }
+	// In quiet mode only the concerning sensors are printed, though the
+	// exit codes are still worked out from every sensor.
+	printed := devices
+	if quietMode {
+		printed = devicesAtThreshold(devices)
+	}
 
-                        fmt.Println(dir.Name(), "  ", paddedName, sensor.intData, sensorLabel)
-                }
+	if quietMode && len(printed) == 0 {
+		// All is well, so print nothing at all, not even a CSV header.
+	} else if jsonOutput {
+		err := printJSON(outputWriter, printed)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	} else if csvOutput {
+		err := printCSV(outputWriter, printed, true, "")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	} else {
+		_, err := printSensors(outputWriter, printed)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if showSummary && !quietMode {
+			printSummary(outputWriter, printed)
+		}
+	}
+
+	// An incomplete scan would make every unread sensor look missing.
+	if !complete {
+		os.Exit(deadlineExitCode)
+	}
+
+	exitCode := 0
+
+	if thresholdTemperature != 0 || len(sensorConfigs) > 0 {
+
+		// The sensors printed already say which ones reached it.
+		var report io.Writer = os.Stderr
+		if quietMode {
+			report = io.Discard
+		}
+
+		exitCode = reportThreshold(report, devices)
+	}
+
+	if baselinePath != "" {
+		if code := reportMissing(os.Stderr); code != 0 {
+			exitCode = code
+		}
+	}
+
+	if requiredDevices != "" {
+		if code := reportRequired(os.Stderr); code != 0 {
+			exitCode = code
+		}
+	}
+
+	os.Exit(exitCode)
+}
+
+//! Scans the hwmon devices, warning if the scan ran out of time.
+/*
+ * @returns    Device[]    devices found
+ *             bool        whether or not every device was read
+ *             error       error message, if any
+ */
+func collectDevices() ([]Device, bool, error) {
+
+	devices, err := ScanDevices()
+
+	// If the scan ran out of time, print whatever was collected.
+	complete := true
+	if err == errScanDeadline {
+		fmt.Fprintln(os.Stderr, "tempchk: warning: the scan deadline of "+
+			scanDeadline.String()+" was exceeded, output is incomplete")
+		complete = false
+		err = nil
+	}
+
+	// safety check, ensure no errors occurred
+	if err != nil {
+		return nil, false, err
+	}
+
+	return sortDevices(devices), complete, nil
+}
+
+//! Orders the sensors of the given devices as per the -sort flag.
+/*
+ * Sorting across devices splits each device into one entry per sensor,
+ * so that e.g. the hottest sensors of two devices can be interleaved.
+ *
+ * @param      Device[]    devices to sort, in directory order
+ *
+ * @returns    Device[]    devices in the requested order
+ */
+func sortDevices(devices []Device) []Device {
+
+	// devices are already in directory order
+	if sortOrder == "device" {
+		return devices
+	}
+
+	entries := make([]Device, 0)
+	for _, device := range devices {
+
+		if len(device.sensors) < 1 {
+			entries = append(entries, device)
+			continue
+		}
+
+		for _, sensor := range device.sensors {
+			entry := device
+			entry.sensors = []tempchk.Sensor{sensor}
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+
+		a, b := entries[i], entries[j]
+
+		if sortOrder == "temp" {
+
+			// temperatures first, then any other sensors, then devices
+			// without any readings
+			aTemp := len(a.sensors) > 0 &&
+				a.sensors[0].Category == tempchk.TempPrefix
+			bTemp := len(b.sensors) > 0 &&
+				b.sensors[0].Category == tempchk.TempPrefix
+			if aTemp != bTemp {
+				return aTemp
+			}
+
+			if len(a.sensors) != len(b.sensors) {
+				return len(a.sensors) > len(b.sensors)
+			}
+
+			if aTemp && a.sensors[0].IntData != b.sensors[0].IntData {
+				return a.sensors[0].IntData > b.sensors[0].IntData
+			}
+
+		} else if a.name != b.name {
+			return a.name < b.name
+		}
+
+		return a.hwmon < b.hwmon
+	})
+
+	return entries
+}
+
+//! Prints the data of the sensors of the given devices.
+/*
+ * @param      io.Writer         destination of the printed output
+ * @param      Device[]          devices to print
+ *
+ * @returns    map[string]int    printed values, keyed by device and sensor
+ *             error             error message, if any
+ */
+func printSensors(w io.Writer, devices []Device) (map[string]int, error) {
+
+	// values of every printed sensor, so that callers can detect changes
+	printedValues := make(map[string]int)
+
+	// Line up the columns, however wide the names and values happen to be;
+	// the table is buffered so the padding after the last cell can be cut.
+	var table bytes.Buffer
+	tw := tabwriter.NewWriter(&table, 0, 0, spacerSize, ' ', 0)
+
+	// Every value is wrapped in escape sequences of the same length when
+	// coloring, so the padding works out as if they were not there.
+	colored := useColor()
+
+	// sensors that matched, when in value-only mode
+	matchedSensors := make([]tempchk.Sensor, 0)
+
+	// For each of the devices...
+	for _, device := range devices {
+
+		// If the device has no sensors, then the temperature file does
+		// not have valid integer data. So tell the end-user no data is
+		// available.
+		if len(device.sensors) < 1 {
+
+			// A device without data has no value worth printing.
+			if valueOnly {
+				continue
+			}
+
+			value := "N/A"
+			if colored {
+				value = uncoloredPrefix + value + colorSuffix
+			}
+
+			// Say why there is no data, to help with diagnosing it.
+			reason := ""
+			if debugMode && device.err != nil {
+				reason = noSensorsReason(device.err)
+			}
+
+			// Finally, print out the temperature data of the current device.
+			if groupByDevice {
+				fmt.Fprintln(tw, device.name+" ("+deviceID(device)+")")
+				fmt.Fprintln(tw, "    "+value+"\t"+reason)
+			} else {
+				fmt.Fprintln(tw, deviceID(device)+"\t"+device.name+"\t\t"+
+					value+"\t"+reason)
+			}
+			printedValues[device.hwmon] = 0
+
+			// With that done, go ahead and move on to the next device.
+			continue
+		}
+
+		// Print the device once, above its sensors, when grouping them.
+		if groupByDevice && !valueOnly {
+			fmt.Fprintln(tw, device.name+" ("+deviceID(device)+")")
+		}
+
+		for _, sensor := range device.sensors {
+
+			// The value is printed only after every device has been
+			// checked, so that multiple matches can be rejected.
+			if valueOnly {
+				matchedSensors = append(matchedSensors, sensor)
+				continue
+			}
+
+			// Prefer the driver's own label, e.g. "Tctl", falling back
+			// to the sensor number if the driver does not provide one.
+			labelText := sensor.Label
+			if labelText == "" {
+				if description, ok := categoryDescriptions[sensor.Category]; ok {
+					labelText = description + " " + strconv.Itoa(sensor.Number)
+				}
+			}
+
+			// anything else worth noting about the sensor, after its label
+			sensorLabel := ""
+
+			// Show the fan's limits, if the driver provides any; a fan
+			// spinning below its minimum may well be failing.
+			if showFanLimits && sensor.Category == tempchk.FanPrefix {
+
+				if minimum, ok := sensor.Limits["_min"]; ok {
+					sensorLabel += "   min " + strconv.Itoa(minimum)
+					if sensor.IntData < minimum {
+						sensorLabel += " BELOW MIN"
+					}
+				}
+
+				if target, ok := sensor.Limits["_target"]; ok {
+					sensorLabel += "   target " + strconv.Itoa(target)
+				}
+			}
+
+			// Show how hard the fan is being driven, and by what.
+			if showFanPWM && sensor.Category == tempchk.FanPrefix {
+				sensorLabel += fanControl(device, sensor)
+			}
+
+			// Show the value as read, so it can be checked against sysfs.
+			if showRawValues {
+				sensorLabel += "   (raw " + strconv.Itoa(sensor.RawData) + ")"
+			}
+
+			// Flag temperatures above their max or crit limit, if known.
+			if tempchk.OverTemperature(sensor) {
+				sensorLabel += "   [HOT]"
+			}
+
+			// Flag sensors the hardware itself considers to be in alarm.
+			if sensor.Alarm {
+				sensorLabel += "   ALARM"
+				printedValues[device.hwmon+"/"+sensor.Category+
+					strconv.Itoa(sensor.Number)+tempchk.AlarmSuffix] = 1
+			}
+
+			// Note which sensors were collapsed into this one, if any.
+			if len(sensor.Aliases) > 0 {
+				merged := make([]string, 0, len(sensor.Aliases))
+				for _, alias := range sensor.Aliases {
+					merged = append(merged, strconv.Itoa(alias))
+				}
+				sensorLabel += "   (merged with " +
+					strings.Join(merged, ", ") + ")"
+			}
+
+			// Mark readings that are likely a driver bug, e.g. 500 C.
+			_, value := sensorValue(sensor)
+			if sensor.Implausible {
+				value += "?"
+			}
+			value += " " + categoryUnit(sensor.Category)
+
+			// Show which way the temperature went since the last refresh.
+			if trendValues != nil && sensor.Category == tempchk.TempPrefix {
+				if previous, ok := trendValues[device.hwmon+"/"+
+					sensor.Category+strconv.Itoa(sensor.Number)]; ok {
+					value += " " + trendArrow(sensor.IntData-previous)
+				}
+			}
+
+			// Show how much of the rated maximum is in use, e.g. 72%.
+			if showHeadroom {
+				if percent, ok := headroomPercent(sensor); ok {
+					value += " (" + strconv.Itoa(percent) + "%)"
+				}
+			}
+
+			// Show how far the sensor has moved since the baseline, e.g.
+			// how much a workload has heated it up since idle.
+			if baselineValues != nil {
+				value += " (" + baselineDelta(device, sensor) + ")"
+			}
+
+			if colored {
+				color := uncoloredPrefix
+				if sensor.Category == tempchk.TempPrefix {
+					color = temperatureColor(sensor.IntData)
+				}
+				value = color + value + colorSuffix
+			}
+
+			if groupByDevice {
+				fmt.Fprintln(tw, "    "+labelText+"\t"+value+"\t"+
+					strings.TrimPrefix(sensorLabel, "   "))
+			} else {
+				fmt.Fprintln(tw, deviceID(device)+"\t"+sensor.Name+"\t"+
+					labelText+"\t"+value+"\t"+
+					strings.TrimPrefix(sensorLabel, "   "))
+			}
+			printedValues[device.hwmon+"/"+sensor.Category+
+				strconv.Itoa(sensor.Number)] = sensor.IntData
+		}
+	}
+
+	tw.Flush()
+
+	for _, line := range strings.SplitAfter(table.String(), "\n") {
+		fmt.Fprint(w, strings.TrimRight(line, " \n"))
+		if strings.HasSuffix(line, "\n") {
+			fmt.Fprintln(w)
+		}
+	}
+
+	// In value-only mode, anything other than exactly one match is
+	// ambiguous, so complain rather than guess which value was wanted.
+	if valueOnly {
+		if len(matchedSensors) != 1 {
+			return printedValues, fmt.Errorf("printSensors(): -value-only "+
+				"expects exactly one matching sensor, but %d matched",
+				len(matchedSensors))
+		}
+
+		// Formatted as in the table, so e.g. voltages keep their decimals.
+		_, value := sensorValue(matchedSensors[0])
+		fmt.Fprintln(w, value)
+		printedValues["value"] = matchedSensors[0].IntData
+	}
+
+	return printedValues, nil
+}
+
+//! Prints the coolest, hottest and average of the temperature sensors.
+/*
+ * @param      io.Writer    destination of the printed output
+ * @param      Device[]     devices to summarize
+ *
+ * @returns    none
+ */
+func printSummary(w io.Writer, devices []Device) {
+
+	var coolest, hottest Device
+	var minimum, maximum, total, count int
+
+	for _, device := range devices {
+		for _, sensor := range device.sensors {
+
+			// fans, voltages and such are not temperatures, and
+			// implausible readings would only skew the figures
+			if sensor.Category != tempchk.TempPrefix || sensor.Implausible {
+				continue
+			}
+
+			if count == 0 || sensor.IntData < minimum {
+				minimum = sensor.IntData
+				coolest = device
+			}
+
+			if count == 0 || sensor.IntData > maximum {
+				maximum = sensor.IntData
+				hottest = device
+			}
+
+			total += sensor.IntData
+			count++
+		}
+	}
+
+	// Without any temperatures, there is nothing to summarize.
+	if count == 0 {
+		return
+	}
+
+	unit := categoryUnit(tempchk.TempPrefix)
+
+	fmt.Fprintln(w, "min "+strconv.Itoa(minimum)+" "+unit+" ("+coolest.name+
+		") / max "+strconv.Itoa(maximum)+" "+unit+" ("+hottest.name+
+		") / avg "+strconv.Itoa(total/count)+" "+unit)
+}
+
+//! Determines the threshold of a temperature sensor.
+/*
+ * Sensors with a threshold in the config file use that, and any others
+ * use the -threshold flag, if given.
+ *
+ * @param      Device    device of the sensor
+ * @param      Sensor    sensor to determine the threshold of
+ *
+ * @returns    int       threshold, in the same unit as the sensor
+ *             bool      whether or not the sensor has a threshold
+ */
+func sensorThreshold(device Device, sensor tempchk.Sensor) (int, bool) {
+
+	if sensor.Category != tempchk.TempPrefix {
+		return 0, false
+	}
+
+	celsius := thresholdTemperature
+	if config, ok := sensorConfigs[sensorIdentity(device, sensor)]; ok &&
+		config.threshold != 0 {
+		celsius = config.threshold
+	}
+
+	if celsius == 0 {
+		return 0, false
+	}
+
+	// The sensors are already corrected and converted, so convert the
+	// threshold too rather than the other way around.
+	return convertTemperature(celsius), true
+}
+
+//! Keeps only the temperature sensors at or above their threshold.
+/*
+ * @param      Device[]    devices of the current scan
+ *
+ * @returns    Device[]    devices with at least one such sensor, along
+ *                         with just those sensors
+ */
+func devicesAtThreshold(devices []Device) []Device {
+
+	concerning := make([]Device, 0)
+
+	for _, device := range devices {
+
+		sensors := make([]tempchk.Sensor, 0)
+		for _, sensor := range device.sensors {
+			threshold, ok := sensorThreshold(device, sensor)
+			if ok && sensor.IntData >= threshold {
+				sensors = append(sensors, sensor)
+			}
+		}
+
+		if len(sensors) == 0 {
+			continue
+		}
+
+		device.sensors = sensors
+		concerning = append(concerning, device)
+	}
+
+	return concerning
+}
+
+//! Reports the temperature sensors at or above their threshold.
+/*
+ * @param      io.Writer    destination of the summary line
+ * @param      Device[]     devices of the current scan
+ *
+ * @returns    int          exit code; the warning exit code if any sensor
+ *                          tripped its threshold, else 0
+ */
+func reportThreshold(w io.Writer, devices []Device) int {
+
+	unit := categoryUnit(tempchk.TempPrefix)
+
+	tripped := make([]string, 0)
+	for _, device := range devices {
+		for _, sensor := range device.sensors {
+
+			threshold, ok := sensorThreshold(device, sensor)
+			if !ok || sensor.IntData < threshold {
+				continue
+			}
+
+			tripped = append(tripped, deviceID(device)+"/"+device.name+" "+
+				sensor.Category+strconv.Itoa(sensor.Number)+" ("+
+				strconv.Itoa(sensor.IntData)+" "+unit+" >= "+
+				strconv.Itoa(threshold)+" "+unit+")")
+		}
+	}
+
+	if len(tripped) == 0 {
+		return 0
+	}
+
+	fmt.Fprintln(w, "tempchk: threshold reached by "+
+		strings.Join(tripped, ", "))
+
+	return warnExitCode
+}
+
+//! Reports the required devices that are missing from the hwmon directory.
+/*
+ * The devices are looked for without any filters, since a device that is
+ * merely filtered out of the output is not missing.
+ *
+ * @param      io.Writer    destination of the report
+ *
+ * @returns    int          exit code; the critical exit code if any
+ *                          required device is missing, else 0
+ */
+func reportRequired(w io.Writer) int {
+
+	present := presentDeviceNames()
+
+	missing := make([]string, 0)
+	for _, name := range strings.Split(requiredDevices, ",") {
+
+		name = normalizeName(name)
+		if name == "" || present[name] {
+			continue
+		}
+
+		missing = append(missing, name)
+	}
+
+	if len(missing) == 0 {
+		return 0
+	}
+
+	fmt.Fprintln(w, "tempchk: required devices are missing: "+
+		strings.Join(missing, ", "))
+
+	return critExitCode
+}
+
+//! Prepares the sensors of the given devices for marshaling.
+/*
+ * @param      Device[]    devices to prepare the sensors of
+ *
+ * @returns    Sensor[]    sensors, in the order they are printed, as
+ *                         identified and with the units they are printed in
+ */
+func jsonSensors(devices []Device) []tempchk.Sensor {
+
+	sensors := make([]tempchk.Sensor, 0)
+
+	for _, device := range devices {
+		for _, sensor := range device.sensors {
+			sensor.Device = deviceID(device)
+			sensor.Name = device.name
+			sensor.Unit = categoryUnit(sensor.Category)
+			sensors = append(sensors, sensor)
+		}
+	}
+
+	return sensors
+}
+
+//! Prints the sensors of the given devices as a JSON array, or as an
+//! object along with the threshold check if -threshold or a config file
+//! is given.
+/*
+ * @param      io.Writer    destination of the printed output
+ * @param      Device[]     devices to print
+ *
+ * @returns    error        error message, if any
+ */
+func printJSON(w io.Writer, devices []Device) error {
+
+	var result interface{} = jsonSensors(devices)
+
+	// Scripts can then go by the status, rather than re-checking the
+	// temperatures against the threshold themselves.
+	if thresholdTemperature != 0 || len(sensorConfigs) > 0 {
+		status := jsonStatus{
+			Status:  "ok",
+			Sensors: jsonSensors(devices),
+			Tripped: jsonSensors(devicesAtThreshold(devices)),
+		}
+		if len(status.Tripped) > 0 {
+			status.Status = "hot"
+		}
+		result = status
+	}
+
+	output, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("printJSON(): unable to marshal the sensors")
+	}
+
+	fmt.Fprintln(w, string(output))
+
+	return nil
+}
+
+//! Prints the sensors of the given devices as CSV rows.
+/*
+ * @param      io.Writer    destination of the printed output
+ * @param      Device[]     devices to print
+ * @param      bool         whether or not to print the header row first
+ * @param      string       timestamp to prefix each row with, if not blank
+ *
+ * @returns    error        error message, if any
+ */
+func printCSV(w io.Writer, devices []Device, header bool,
+	timestamp string) error {
+
+	cw := csv.NewWriter(w)
+
+	if header {
+		columns := csvHeader
+		if timestamp != "" {
+			columns = append([]string{"timestamp"}, csvHeader...)
+		}
+		cw.Write(columns)
+	}
+
+	for _, device := range devices {
+		for _, sensor := range device.sensors {
+
+			_, value := sensorValue(sensor)
+			row := []string{
+				deviceID(device),
+				device.name,
+				sensor.Label,
+				sensor.Category,
+				strconv.Itoa(sensor.Number),
+				value,
+				categoryUnit(sensor.Category),
+			}
+
+			if timestamp != "" {
+				row = append([]string{timestamp}, row...)
+			}
+
+			cw.Write(row)
+		}
+	}
+
+	cw.Flush()
+	if cw.Error() != nil {
+		return fmt.Errorf("printCSV(): unable to write the sensors")
+	}
+
+	return nil
+}
+
+//! Prints every attribute file of each sensor, grouped per sensor.
+/*
+ * @param      io.Writer    destination of the printed output
+ *
+ * @returns    error        error message, if any
+ */
+func printAllAttributes(w io.Writer) error {
+
+	devices, err := ScanDevices()
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		for _, sensor := range device.sensors {
+
+			prefix := sensor.Category + strconv.Itoa(sensor.Number)
+
+			fmt.Fprintln(w, device.hwmon, "  ", device.name, "  ", prefix)
+
+			for _, suffix := range sensorAttributeSuffixes {
+
+				// Most drivers only provide some of the attributes.
+				value, err := tempchk.ReadAttribute(device.hwmon, prefix+suffix)
+				if err != nil {
+					value = "N/A"
+				}
+
+				fmt.Fprintf(w, "    %-12s%s\n", strings.TrimPrefix(suffix, "_"),
+					value)
+			}
+
+			fmt.Fprintln(w)
+		}
+	}
+
+	return nil
+}
+
+//! Prints each device along with the number of temp and fan sensors found.
+/*
+ * @param      io.Writer    destination of the printed output
+ *
+ * @returns    error        error message, if any
+ */
+func printDeviceList(w io.Writer) error {
+
+	dirs, err := tempchk.DefaultFileSystem.ReadDir(
+		tempchk.HardwareMonitorDirectory)
+	if err != nil {
+		return fmt.Errorf("printDeviceList(): unable to read %s",
+			tempchk.HardwareMonitorDirectory)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, spacerSize, ' ', 0)
+
+	for _, device := range listDevices(dirs) {
+		fmt.Fprintln(tw, deviceID(device)+"\t"+device.name+"\t"+
+			strconv.Itoa(countSensorFiles(device.hwmon, tempchk.TempPrefix))+
+			" temp\t"+
+			strconv.Itoa(countSensorFiles(device.hwmon, tempchk.FanPrefix))+
+			" fan")
+	}
+
+	err = tw.Flush()
+	if err != nil {
+		return fmt.Errorf("printDeviceList(): unable to write the devices")
+	}
+
+	return nil
+}
+
+//! Determines the arrow showing the trend of a temperature.
+/*
+ * @param      int       change of the temperature since the last refresh
+ *
+ * @returns    string    arrow pointing up, down or across if steady
+ */
+func trendArrow(change int) string {
+
+	switch {
+	case change > trendDeadband:
+		return "↑"
+	case change < -trendDeadband:
+		return "↓"
+	}
+
+	return "→"
+}
+
+//! Listens for SIGHUP, the request to rescan the hwmon directory.
+/*
+ * @returns    chan    notified of each SIGHUP; stop it via signal.Stop
+ */
+func notifyRescans() chan os.Signal {
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	return hangups
+}
+
+//! Forgets the cached device names, so that the next scan starts afresh;
+//! e.g. after hotplugging hardware or loading a module.
+/*
+ * @returns    none
+ */
+func rescanDevices() {
+	debug("Received SIGHUP, rescanning the hwmon directory")
+	deviceNames.reset()
+}
+
+//! Polls the sensors, redrawing the output only when a value has changed.
+/*
+ * @returns    none
+ */
+func watchForChanges() {
+
+	var lastValues map[string]int
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	hangups := notifyRescans()
+	defer signal.Stop(hangups)
+
+	for {
+		devices, _, err := collectDevices()
+
+		// A failed scan may well succeed on the next poll, so keep the
+		// last render up and try again.
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			var output bytes.Buffer
+			values, err := printSensors(&output, devices)
+			if err != nil {
+				fmt.Fprintln(&output, err)
+			}
+
+			// Only redraw when at least one sensor differs from the last
+			// render, so that the terminal is not needlessly churned.
+			if lastValues == nil || !sameValues(lastValues, values) {
+				fmt.Fprint(outputWriter, "\033[H\033[2J")
+				fmt.Fprint(outputWriter, output.String())
+				lastValues = values
+			}
+		}
+
+		select {
+		case <-signals:
+			return
+		case <-hangups:
+			rescanDevices()
+		case <-time.After(refreshPollInterval):
+		}
+	}
+}
+
+//! Re-reads and re-prints the sensors at every watch interval.
+/*
+ * @returns    none
+ */
+func watchSensors() {
+
+	// Exit cleanly on Ctrl-C, rather than being killed mid-print.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	// A SIGHUP re-reads at once, leaving the interval ticker as is.
+	hangups := notifyRescans()
+	defer signal.Stop(hangups)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	// CSV rows are appended rather than redrawn, so they can be logged.
+	header := true
+
+	for {
+		devices, _, err := collectDevices()
+
+		// A failed scan may well succeed at the next interval, so report
+		// it and carry on watching.
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else if csvOutput {
+			err := printCSV(outputWriter, devices, header,
+				time.Now().Format(time.RFC3339))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			header = false
+		} else {
+
+			// Render off-screen first, so the screen is only briefly blank.
+			var output bytes.Buffer
+			values, err := printSensors(&output, devices)
+			if err != nil {
+				fmt.Fprintln(&output, err)
+			}
+			trendValues = values
+
+			fmt.Fprint(outputWriter, "\033[H\033[2J")
+			fmt.Fprint(outputWriter, output.String())
+		}
+
+		select {
+		case <-signals:
+			return
+		case <-hangups:
+			rescanDevices()
+		case <-ticker.C:
+		}
 	}
 }
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rbisewski/tempchk/pkg/tempchk"
+)
+
+// Checks that a required device hidden by the filters is not reported as
+// missing, while one that is absent from the hwmon directory is.
+func TestReportRequiredIgnoresFilters(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "k10temp\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "45000\n",
+		"/sys/class/hwmon/hwmon0/temp1_label": "Tctl\n",
+		"/sys/class/hwmon/hwmon1/name":        "acpitz\n",
+		"/sys/class/hwmon/hwmon1/temp1_input": "30000\n",
+		"/sys/class/hwmon/hwmon2/name":        "nvme\n",
+		"/sys/class/hwmon/hwmon2/temp1_input": "38900\n",
+		"/sys/class/hwmon/hwmon2/temp1_label": "Composite\n",
+	})
+
+	required, device, label := requiredDevices, deviceFilter, labelFilter
+	t.Cleanup(func() {
+		requiredDevices, deviceFilter, labelFilter = required, device, label
+	})
+
+	tests := []struct {
+		required string
+		device   string
+		label    string
+		code     int
+		report   string
+	}{
+		{"nvme", "", "Tctl", 0, ""},
+		{"nvme,k10temp", "acpitz", "", 0, ""},
+		{"nvme, it8792", "k10temp", "", critExitCode,
+			"tempchk: required devices are missing: it8792\n"},
+	}
+
+	for _, test := range tests {
+
+		requiredDevices = test.required
+		deviceFilter, labelFilter = test.device, test.label
+
+		// The filters hide the required device from the scan itself.
+		devices, err := ScanDevices()
+		if err != nil {
+			t.Fatalf("ScanDevices() error = %v", err)
+		}
+		for _, device := range devices {
+			if device.name == "nvme" {
+				t.Fatalf("-device %q -label %q did not hide nvme",
+					test.device, test.label)
+			}
+		}
+
+		var report bytes.Buffer
+		code := reportRequired(&report)
+
+		if code != test.code || report.String() != test.report {
+			t.Errorf("-require %q -device %q -label %q: reportRequired() = "+
+				"%d, %q, want %d, %q", test.required, test.device,
+				test.label, code, report.String(), test.code, test.report)
+		}
+	}
+}
+
+// Checks that a sensor merged with its aliases notes them, set apart from
+// the value like every other note.
+func TestPrintSensorsMergedNote(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "nct6798\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "35000\n",
+		"/sys/class/hwmon/hwmon0/temp1_label": "SYSTIN\n",
+		"/sys/class/hwmon/hwmon0/temp1_alarm": "1\n",
+		"/sys/class/hwmon/hwmon0/temp2_input": "35000\n",
+		"/sys/class/hwmon/hwmon0/temp2_label": "SYSTIN\n",
+		"/sys/class/hwmon/hwmon0/temp3_input": "40000\n",
+		"/sys/class/hwmon/hwmon0/temp3_label": "CPUTIN\n",
+	})
+
+	merge, color := mergeDuplicateSensors, colorMode
+	mergeDuplicateSensors, colorMode = true, "never"
+	t.Cleanup(func() { mergeDuplicateSensors, colorMode = merge, color })
+
+	devices, err := ScanDevices()
+	if err != nil {
+		t.Fatalf("ScanDevices() error = %v", err)
+	}
+
+	var output bytes.Buffer
+	printSensors(&output, devices)
+
+	want := "hwmon0    nct6798    SYSTIN    35 C    ALARM   (merged with 2)\n" +
+		"hwmon0    nct6798    CPUTIN    40 C\n"
+	if output.String() != want {
+		t.Errorf("printSensors() printed %q, want %q", output.String(), want)
+	}
+}
+
+// Checks that a sensor below its threshold exits cleanly, while one at or
+// above it exits with the -warn-exit-code, preferring any threshold of the
+// config file over -threshold.
+func TestReportThreshold(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "coretemp\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "70000\n",
+		"/sys/class/hwmon/hwmon1/name":        "nvme\n",
+		"/sys/class/hwmon/hwmon1/temp1_input": "50000\n",
+		"/sys/class/hwmon/hwmon1/fan1_input":  "1200\n",
+	})
+
+	threshold, configs, code := thresholdTemperature, sensorConfigs,
+		warnExitCode
+	t.Cleanup(func() {
+		thresholdTemperature, sensorConfigs, warnExitCode = threshold,
+			configs, code
+	})
+
+	devices, err := ScanDevices()
+	if err != nil {
+		t.Fatalf("ScanDevices() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		threshold int
+		configs   map[string]sensorConfig
+		warn      int
+		code      int
+		report    string
+	}{
+		{"below", 71, nil, 1, 0, ""},
+		{"at", 70, nil, 1, 1, "tempchk: threshold reached by " +
+			"hwmon0/coretemp temp1 (70 C >= 70 C)\n"},
+		{"above", 50, nil, 3, 3, "tempchk: threshold reached by " +
+			"hwmon0/coretemp temp1 (70 C >= 50 C), hwmon1/nvme temp1 " +
+			"(50 C >= 50 C)\n"},
+		{"config below", 50, map[string]sensorConfig{
+			"coretemp temp1": {threshold: 85},
+			"nvme temp1":     {threshold: 60},
+		}, 1, 0, ""},
+		{"config at", 0, map[string]sensorConfig{
+			"nvme temp1": {threshold: 50},
+		}, 1, 1, "tempchk: threshold reached by hwmon1/nvme temp1 " +
+			"(50 C >= 50 C)\n"},
+		{"config label only", 90, map[string]sensorConfig{
+			"coretemp temp1": {label: "CPU die"},
+		}, 1, 0, ""},
+	}
+
+	for _, test := range tests {
+
+		thresholdTemperature, sensorConfigs = test.threshold, test.configs
+		warnExitCode = test.warn
+
+		var report bytes.Buffer
+		code := reportThreshold(&report, devices)
+
+		if code != test.code || report.String() != test.report {
+			t.Errorf("%s: reportThreshold() = %d, %q, want %d, %q", test.name,
+				code, report.String(), test.code, test.report)
+		}
+	}
+}
+
+// Checks that a critical state, e.g. a required device that is missing,
+// exits with the -crit-exit-code.
+func TestCritExitCode(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "k10temp\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "45000\n",
+	})
+
+	required, code := requiredDevices, critExitCode
+	t.Cleanup(func() { requiredDevices, critExitCode = required, code })
+
+	requiredDevices = "nvme"
+
+	for _, critExitCode = range []int{2, 4} {
+
+		var report bytes.Buffer
+		if code := reportRequired(&report); code != critExitCode {
+			t.Errorf("-crit-exit-code %d: reportRequired() = %d",
+				critExitCode, code)
+		}
+	}
+}
+
+// Checks that -show-fan-limits notes the minimum and target of each fan,
+// whichever of the files are present, and flags fans below their minimum.
+func TestPrintSensorsFanLimits(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":         "it8792\n",
+		"/sys/class/hwmon/hwmon0/fan1_input":   "250\n",
+		"/sys/class/hwmon/hwmon0/fan1_min":     "300\n",
+		"/sys/class/hwmon/hwmon0/fan1_target":  "900\n",
+		"/sys/class/hwmon/hwmon0/fan2_input":   "1200\n",
+		"/sys/class/hwmon/hwmon0/fan2_min":     "300\n",
+		"/sys/class/hwmon/hwmon0/fan3_input":   "1500\n",
+		"/sys/class/hwmon/hwmon0/fan3_target":  "1500\n",
+		"/sys/class/hwmon/hwmon0/fan4_input":   "0\n",
+		"/sys/class/hwmon/hwmon0/temp1_input":  "40000\n",
+		"/sys/class/hwmon/hwmon0/temp1_min":    "50000\n",
+		"/sys/class/hwmon/hwmon0/temp1_target": "45000\n",
+	})
+
+	limits, color := showFanLimits, colorMode
+	colorMode = "never"
+	t.Cleanup(func() { showFanLimits, colorMode = limits, color })
+
+	devices, err := ScanDevices()
+	if err != nil {
+		t.Fatalf("ScanDevices() error = %v", err)
+	}
+
+	tests := []struct {
+		show   bool
+		output string
+	}{
+		{false, "hwmon0    it8792    temperature sensor 1    40 C\n" +
+			"hwmon0    it8792    fan sensor 1            250 RPM\n" +
+			"hwmon0    it8792    fan sensor 2            1200 RPM\n" +
+			"hwmon0    it8792    fan sensor 3            1500 RPM\n" +
+			"hwmon0    it8792    fan sensor 4            0 RPM\n"},
+		{true, "hwmon0    it8792    temperature sensor 1    40 C\n" +
+			"hwmon0    it8792    fan sensor 1            250 RPM     " +
+			"min 300 BELOW MIN   target 900\n" +
+			"hwmon0    it8792    fan sensor 2            1200 RPM    " +
+			"min 300\n" +
+			"hwmon0    it8792    fan sensor 3            1500 RPM    " +
+			"target 1500\n" +
+			"hwmon0    it8792    fan sensor 4            0 RPM\n"},
+	}
+
+	for _, test := range tests {
+
+		showFanLimits = test.show
+
+		var output bytes.Buffer
+		printSensors(&output, devices)
+
+		if output.String() != test.output {
+			t.Errorf("-show-fan-limits=%v printed %q, want %q", test.show,
+				output.String(), test.output)
+		}
+	}
+}
+
+// Checks that -json prints the threshold check along with the sensors once
+// a threshold is given by either -threshold or the config file.
+func TestPrintJSONStatus(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{
+		"/sys/class/hwmon/hwmon0/name":        "coretemp\n",
+		"/sys/class/hwmon/hwmon0/temp1_input": "70000\n",
+	})
+
+	threshold, configs := thresholdTemperature, sensorConfigs
+	t.Cleanup(func() { thresholdTemperature, sensorConfigs = threshold, configs })
+
+	devices, err := ScanDevices()
+	if err != nil {
+		t.Fatalf("ScanDevices() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		threshold int
+		configs   map[string]sensorConfig
+		status    string
+	}{
+		{"none", 0, nil, ""},
+		{"-threshold", 80, nil, "ok"},
+		{"config", 0, map[string]sensorConfig{
+			"coretemp temp1": {threshold: 70},
+		}, "hot"},
+	}
+
+	for _, test := range tests {
+
+		thresholdTemperature, sensorConfigs = test.threshold, test.configs
+
+		var output bytes.Buffer
+		if err := printJSON(&output, devices); err != nil {
+			t.Fatalf("%s: printJSON() error = %v", test.name, err)
+		}
+
+		var status jsonStatus
+		err := json.Unmarshal(output.Bytes(), &status)
+		if test.status == "" {
+			if err == nil {
+				t.Errorf("%s: printJSON() printed %s, want an array",
+					test.name, output.String())
+			}
+			continue
+		}
+		if err != nil || status.Status != test.status {
+			t.Errorf("%s: printJSON() printed %s, want status %q", test.name,
+				output.String(), test.status)
+		}
+	}
+}
+
+// Checks that a failed scan is returned to the caller, rather than exiting,
+// so that the watch modes can carry on and try again.
+func TestCollectDevicesError(t *testing.T) {
+
+	useMemoryFileSystem(t, tempchk.MemoryFileSystem{})
+
+	devices, _, err := collectDevices()
+	if !errors.Is(err, tempchk.ErrHwmonNotFound) || devices != nil {
+		t.Errorf("collectDevices() = %v, %v, want ErrHwmonNotFound", devices,
+			err)
+	}
+
+	var output bytes.Buffer
+	err = printAllAttributes(&output)
+	if !errors.Is(err, tempchk.ErrHwmonNotFound) || output.Len() != 0 {
+		t.Errorf("printAllAttributes() printed %q, %v, want ErrHwmonNotFound",
+			output.String(), err)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rbisewski/tempchk/pkg/tempchk"
+)
+
+// columns of the TUI table, in the order they are sorted by
+var tuiColumns = []string{"device", "name", "sensor", "value"}
+
+// width of the temperature bars, in characters
+var tuiBarWidth = 20
+
+// temperature, in degrees Celsius, that fills the bar of a sensor without
+// a max limit of its own
+var tuiBarDefaultMaximum = 100
+
+// A single row of the TUI table.
+type tuiRow struct {
+
+	// hwmon directory of the device; e.g. hwmon0
+	hwmon string
+
+	// name of the device
+	name string
+
+	// sensor description; e.g. Tctl or temp1
+	sensor string
+
+	// scaled sensor value
+	value int
+
+	// whether or not the device has any readable value
+	valid bool
+
+	// sensor type; e.g. temp or fan
+	category string
+
+	// temperature as a percentage of its max limit, for the bar; -1 if
+	// the sensor is not a temperature
+	percent int
+}
+
+//! Assembles the rows of the TUI table from the scanned devices.
+/*
+ * @param      Device[]    devices to display
+ *
+ * @returns    tuiRow[]    table rows
+ */
+func tuiRows(devices []Device) []tuiRow {
+
+	rows := make([]tuiRow, 0)
+
+	for _, device := range devices {
+
+		if len(device.sensors) < 1 {
+			rows = append(rows, tuiRow{
+				hwmon:   deviceID(device),
+				name:    device.name,
+				sensor:  "N/A",
+				percent: -1,
+			})
+			continue
+		}
+
+		for _, sensor := range device.sensors {
+
+			description := sensor.Label
+			if description == "" {
+				description = sensor.Category + strconv.Itoa(sensor.Number)
+			}
+
+			// Scale the bar by the sensor's own max limit, if it has one.
+			percent, ok := headroomPercent(sensor)
+			if !ok {
+				percent = -1
+				if sensor.Category == tempchk.TempPrefix {
+					percent = celsiusTemperature(sensor.IntData) * 100 /
+						tuiBarDefaultMaximum
+				}
+			}
+
+			// Temperatures below zero simply get an empty bar.
+			if sensor.Category == tempchk.TempPrefix && percent < 0 {
+				percent = 0
+			}
+
+			rows = append(rows, tuiRow{
+				hwmon:    deviceID(device),
+				name:     device.name,
+				sensor:   description,
+				value:    sensor.IntData,
+				valid:    true,
+				category: sensor.Category,
+				percent:  percent,
+			})
+		}
+	}
+
+	return rows
+}
+
+//! Sorts the TUI rows by the given column.
+/*
+ * @param      tuiRow[]    rows to sort, in place
+ * @param      int         index of the column to sort by
+ *
+ * @returns    none
+ */
+func sortTuiRows(rows []tuiRow, column int) {
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		switch tuiColumns[column] {
+		case "name":
+			return rows[i].name < rows[j].name
+		case "sensor":
+			return rows[i].sensor < rows[j].sensor
+		case "value":
+			// hottest first, with unreadable devices last
+			if rows[i].valid != rows[j].valid {
+				return rows[i].valid
+			}
+			return rows[i].value > rows[j].value
+		}
+		return rows[i].hwmon < rows[j].hwmon
+	})
+}
+
+//! Determines the color band of a given sensor value.
+/*
+ * @param      tuiRow         row to color
+ *
+ * @returns    tcell.Style    style of the value; green, yellow once warm,
+ *                            or red once hot
+ */
+func tuiStyle(row tuiRow) tcell.Style {
+
+	style := tcell.StyleDefault
+
+	// only temperatures have meaningful color bands
+	if !row.valid || row.category != tempchk.TempPrefix {
+		return style
+	}
+
+	switch {
+	case row.value >= convertTemperature(hotTemperature):
+		return style.Foreground(tcell.ColorRed)
+	case row.value >= convertTemperature(warmTemperature):
+		return style.Foreground(tcell.ColorYellow)
+	}
+
+	return style.Foreground(tcell.ColorGreen)
+}
+
+//! Formats the value of a row, as shown in the value column.
+/*
+ * @param      tuiRow    row to format the value of
+ *
+ * @returns    string    value, or N/A if the device has no readable value
+ */
+func tuiValue(row tuiRow) string {
+
+	if !row.valid {
+		return "N/A"
+	}
+
+	return strconv.Itoa(row.value)
+}
+
+//! Draws the bar of a row, filled in proportion to its temperature.
+/*
+ * @param      tuiRow    row to draw the bar of
+ *
+ * @returns    string    bar, e.g. [#####-----], or blank if the row is not
+ *                       a temperature
+ */
+func tuiBar(row tuiRow) string {
+
+	if row.percent < 0 {
+		return ""
+	}
+
+	filled := row.percent * tuiBarWidth / 100
+	if filled > tuiBarWidth {
+		filled = tuiBarWidth
+	}
+
+	return "[" + strings.Repeat("#", filled) +
+		strings.Repeat("-", tuiBarWidth-filled) + "]"
+}
+
+//! Prints text onto the screen, one cell per character.
+/*
+ * @param      tcell.Screen    screen to print onto
+ * @param      int             column to start at
+ * @param      int             row to print on
+ * @param      tcell.Style     style of the text
+ * @param      string          text to print
+ *
+ * @returns    int             column just past the end of the text
+ */
+func tuiPrint(screen tcell.Screen, x int, y int, style tcell.Style,
+	text string) int {
+
+	for _, r := range text {
+		screen.SetContent(x, y, r, nil, style)
+		x++
+	}
+
+	return x
+}
+
+//! Draws a single frame of the TUI.
+/*
+ * @param      tcell.Screen    screen to draw onto
+ * @param      int             index of the column the rows are sorted by
+ *
+ * @returns    none
+ */
+func drawTui(screen tcell.Screen, column int) {
+
+	// Scan afresh on every frame, so that hotplugged devices show up.
+	devices, err := ScanDevices()
+
+	screen.Clear()
+
+	tuiPrint(screen, 0, 0, tcell.StyleDefault, "tempchk    q: quit    "+
+		"s: sort (by "+tuiColumns[column]+")")
+
+	rows := tuiRows(devices)
+	sortTuiRows(rows, column)
+
+	// width of each column, wide enough for the longest cell of any column
+	width := 0
+	for _, name := range tuiColumns {
+		if len(name)+2 > width {
+			width = len(name) + 2
+		}
+	}
+	for _, row := range rows {
+		for _, cell := range []string{row.hwmon, row.name, row.sensor,
+			tuiValue(row)} {
+			if len(cell) > width {
+				width = len(cell)
+			}
+		}
+	}
+	width += spacerSize
+
+	bold := tcell.StyleDefault.Bold(true)
+	for i, name := range tuiColumns {
+		if i == column {
+			name = "[" + name + "]"
+		}
+		tuiPrint(screen, i*width, 2, bold, name)
+	}
+
+	y := 3
+	if err != nil {
+		tuiPrint(screen, 0, y, tcell.StyleDefault, err.Error())
+		y++
+	}
+
+	for _, row := range rows {
+
+		tuiPrint(screen, 0, y, tcell.StyleDefault, row.hwmon)
+		tuiPrint(screen, width, y, tcell.StyleDefault, row.name)
+		tuiPrint(screen, 2*width, y, tcell.StyleDefault, row.sensor)
+
+		style := tuiStyle(row)
+		tuiPrint(screen, 3*width, y, style, tuiValue(row))
+		tuiPrint(screen, 4*width, y, style, tuiBar(row))
+
+		y++
+	}
+
+	screen.Show()
+}
+
+//! Runs the interactive TUI until the end-user quits.
+/*
+ * @returns    error    whether or not the terminal could be set up
+ */
+func runTui() error {
+
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return fmt.Errorf("runTui(): unable to open the terminal, %s", err)
+	}
+
+	err = screen.Init()
+	if err != nil {
+		return fmt.Errorf("runTui(): unable to set up the terminal, %s", err)
+	}
+
+	// Restore the terminal however the TUI ends, even on a panic.
+	defer screen.Fini()
+
+	screen.HideCursor()
+
+	// Ctrl-C is read as a keypress, but a SIGTERM should quit just like q.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	// PollEvent returns nil once the screen is finalized, which ends this.
+	events := make(chan tcell.Event)
+	go func() {
+		for {
+			event := screen.PollEvent()
+			if event == nil {
+				close(events)
+				return
+			}
+			events <- event
+		}
+	}()
+
+	interval := watchInterval
+	if interval <= 0 {
+		interval = defaultRefreshInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	hangups := notifyRescans()
+	defer signal.Stop(hangups)
+
+	column := 0
+	drawTui(screen, column)
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			switch event := event.(type) {
+			case *tcell.EventKey:
+				if event.Key() == tcell.KeyCtrlC || event.Rune() == 'q' {
+					return nil
+				}
+				if event.Rune() == 's' {
+					column = (column + 1) % len(tuiColumns)
+					drawTui(screen, column)
+				}
+			case *tcell.EventResize:
+				screen.Sync()
+				drawTui(screen, column)
+			}
+		case <-ticker.C:
+			drawTui(screen, column)
+		case <-hangups:
+			rescanDevices()
+			drawTui(screen, column)
+		case <-signals:
+			return nil
+		}
+	}
+}